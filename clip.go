@@ -0,0 +1,100 @@
+package sr
+
+// vertex is a transformed vertex on its way to the rasterizer. Clipping
+// creates new vertices by interpolating every field linearly in clip space.
+type vertex struct {
+    clip      Vec4
+    color     SRColor
+    specular  SRColor               // secondary color of LIGHT_MODEL_COLOR_CONTROL
+    eye       Vec3                  // eye-space position and normal, for PHONG shading
+    normal    Vec3
+    texCoords [maxTextureUnits]Vec4 // s, t, r, q of each unit after its texture matrix
+    fog       float32               // fog distance, or factor when fog is per vertex
+}
+
+func lerpVertex(a, b vertex, t float32) vertex {
+    v := vertex{
+        clip:     Vec4{
+            a.clip.x + (b.clip.x-a.clip.x)*t,
+            a.clip.y + (b.clip.y-a.clip.y)*t,
+            a.clip.z + (b.clip.z-a.clip.z)*t,
+            a.clip.w + (b.clip.w-a.clip.w)*t,
+        },
+        color:    a.color.scale(1 - t).add(b.color.scale(t)),
+        specular: a.specular.scale(1 - t).add(b.specular.scale(t)),
+        eye:      a.eye.scale(1 - t).add(b.eye.scale(t)),
+        normal:   a.normal.scale(1 - t).add(b.normal.scale(t)),
+        fog:      a.fog*(1-t) + b.fog*t,
+    }
+    for u := range v.texCoords {
+        v.texCoords[u] = a.texCoords[u].scale(1 - t).add(b.texCoords[u].scale(t))
+    }
+    return v
+}
+
+// clipPlanes are the six frustum planes -w <= x, y, z <= w, as signed
+// distances that are negative outside the view volume.
+var clipPlanes = [6]func(v Vec4) float32{
+    func(v Vec4) float32 { return v.w + v.x },
+    func(v Vec4) float32 { return v.w - v.x },
+    func(v Vec4) float32 { return v.w + v.y },
+    func(v Vec4) float32 { return v.w - v.y },
+    func(v Vec4) float32 { return v.w + v.z },
+    func(v Vec4) float32 { return v.w - v.z },
+}
+
+// clipPolygon clips a convex polygon against the view volume
+// (Sutherland-Hodgman), returning fewer than three vertices when nothing
+// is left.
+func clipPolygon(poly []vertex) []vertex {
+    for _, plane := range clipPlanes {
+        if len(poly) == 0 {
+            break
+        }
+        var out []vertex
+        prev := poly[len(poly)-1]
+        dPrev := plane(prev.clip)
+        for _, cur := range poly {
+            dCur := plane(cur.clip)
+            if (dPrev >= 0) != (dCur >= 0) { // edge crosses the plane
+                out = append(out, lerpVertex(prev, cur, dPrev/(dPrev-dCur)))
+            }
+            if dCur >= 0 {
+                out = append(out, cur)
+            }
+            prev, dPrev = cur, dCur
+        }
+        poly = out
+    }
+    return poly
+}
+
+// clipLine clips the segment a-b against the view volume, reporting false
+// when it is entirely outside.
+func clipLine(a, b vertex) (vertex, vertex, bool) {
+    t0, t1 := float32(0), float32(1)
+    for _, plane := range clipPlanes {
+        da, db := plane(a.clip), plane(b.clip)
+        switch {
+        case da < 0 && db < 0:
+            return a, b, false
+        case da < 0:
+            t0 = max(t0, da/(da-db))
+        case db < 0:
+            t1 = min(t1, da/(da-db))
+        }
+    }
+    if t0 > t1 {
+        return a, b, false
+    }
+    return lerpVertex(a, b, t0), lerpVertex(a, b, t1), true
+}
+
+func insideClipVolume(v vertex) bool {
+    for _, plane := range clipPlanes {
+        if plane(v.clip) < 0 {
+            return false
+        }
+    }
+    return true
+}
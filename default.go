@@ -0,0 +1,80 @@
+package sr
+
+import "image"
+
+// The package-level functions below draw through a default Context, so
+// single-renderer programs can keep using the package the way it always
+// worked. Programs that need several renderers should use NewContext.
+
+var defaultContext = NewContext()
+
+// Default returns the Context used by the package-level functions.
+func Default() *Context {
+    return defaultContext
+}
+
+func Viewport(h, v int)                              { defaultContext.Viewport(h, v) }
+func XY() (int, int)                                 { return defaultContext.XY() }
+func PolygonMode(face, mode int)                     { defaultContext.PolygonMode(face, mode) }
+func Enable(v int)                                   { defaultContext.Enable(v) }
+func Disable(v int)                                  { defaultContext.Disable(v) }
+func Hint(target, mode int)                          { defaultContext.Hint(target, mode) }
+func Lightfv(id, attribute int, value []float32)     { defaultContext.Lightfv(id, attribute, value) }
+func Vertex3f(x, y, z float32)                       { defaultContext.Vertex3f(x, y, z) }
+func Translatef(x, y, z float32)                     { defaultContext.Translatef(x, y, z) }
+func Rotatef(angle, x, y, z float32)                 { defaultContext.Rotatef(angle, x, y, z) }
+func Color3f(r, g, b float32)                        { defaultContext.Color3f(r, g, b) }
+func Begin(mode int)                                 { defaultContext.Begin(mode) }
+func End()                                           { defaultContext.End() }
+func ReadPixels() [][3]float32                       { return defaultContext.ReadPixels() }
+func ClearColor(r, g, b float32)                     { defaultContext.ClearColor(r, g, b) }
+func SetCamera(projection, view [16]float32)         { defaultContext.SetCamera(projection, view) }
+func SetWorkers(n int)                               { defaultContext.SetWorkers(n) }
+func Scalef(x, y, z float32)                         { defaultContext.Scalef(x, y, z) }
+func MatrixMode(mode int)                            { defaultContext.MatrixMode(mode) }
+func PushMatrix()                                    { defaultContext.PushMatrix() }
+func PopMatrix()                                     { defaultContext.PopMatrix() }
+func LoadIdentity()                                  { defaultContext.LoadIdentity() }
+func LoadMatrixf(m [16]float32)                      { defaultContext.LoadMatrixf(m) }
+func MultMatrixf(m [16]float32)                      { defaultContext.MultMatrixf(m) }
+func GetError() int                                  { return defaultContext.GetError() }
+func DepthFunc(fn int)                               { defaultContext.DepthFunc(fn) }
+func DepthMask(flag bool)                            { defaultContext.DepthMask(flag) }
+func DepthRange(near, far float32)                   { defaultContext.DepthRange(near, far) }
+func ClearDepth(d float32)                           { defaultContext.ClearDepth(d) }
+func FrontFace(mode int)                             { defaultContext.FrontFace(mode) }
+func CullFace(mode int)                              { defaultContext.CullFace(mode) }
+func ShadeModel(mode int)                            { defaultContext.ShadeModel(mode) }
+func Normal3f(x, y, z float32)                       { defaultContext.Normal3f(x, y, z) }
+func Materialfv(face, pname int, value []float32)    { defaultContext.Materialfv(face, pname, value) }
+func LightModeli(pname, param int)                   { defaultContext.LightModeli(pname, param) }
+func LightModelfv(pname int, value []float32)        { defaultContext.LightModelfv(pname, value) }
+func ColorMaterial(face, mode int)                   { defaultContext.ColorMaterial(face, mode) }
+func GenTextures(n int) []int                        { return defaultContext.GenTextures(n) }
+func DeleteTextures(names []int)                     { defaultContext.DeleteTextures(names) }
+func BindTexture(target, texture int)                { defaultContext.BindTexture(target, texture) }
+func TexImage2D(target, level, width, height, format int, pixels []float32) { defaultContext.TexImage2D(target, level, width, height, format, pixels) }
+func TexImage2DFromImage(target, level int, img image.Image) { defaultContext.TexImage2DFromImage(target, level, img) }
+func TexSubImage2D(target, level, x, y, width, height, format int, pixels []float32) { defaultContext.TexSubImage2D(target, level, x, y, width, height, format, pixels) }
+func TexParameteri(target, pname, param int)         { defaultContext.TexParameteri(target, pname, param) }
+func TexCoord2f(s, t float32)                        { defaultContext.TexCoord2f(s, t) }
+func TexParameterf(target, pname int, param float32) { defaultContext.TexParameterf(target, pname, param) }
+func GenerateMipmap(target int)                      { defaultContext.GenerateMipmap(target) }
+func TexEnvi(target, pname, param int)               { defaultContext.TexEnvi(target, pname, param) }
+func TexEnvfv(target, pname int, value []float32)    { defaultContext.TexEnvfv(target, pname, value) }
+func TexGeni(coord, pname, param int)                { defaultContext.TexGeni(coord, pname, param) }
+func TexGenfv(coord, pname int, value []float32)     { defaultContext.TexGenfv(coord, pname, value) }
+func ActiveTexture(texture int)                      { defaultContext.ActiveTexture(texture) }
+func MultiTexCoord2f(target int, s, t float32)       { defaultContext.MultiTexCoord2f(target, s, t) }
+func Color4f(r, g, b, a float32)                     { defaultContext.Color4f(r, g, b, a) }
+func ClearColor4f(r, g, b, a float32)                { defaultContext.ClearColor4f(r, g, b, a) }
+func ReadPixelsRGBA() [][4]float32                   { return defaultContext.ReadPixelsRGBA() }
+func BlendFunc(src, dst int)                         { defaultContext.BlendFunc(src, dst) }
+func BlendFuncSeparate(srcRGB, dstRGB, srcAlpha, dstAlpha int) { defaultContext.BlendFuncSeparate(srcRGB, dstRGB, srcAlpha, dstAlpha) }
+func BlendEquation(mode int)                         { defaultContext.BlendEquation(mode) }
+func AlphaFunc(fn int, ref float32)                  { defaultContext.AlphaFunc(fn, ref) }
+func Fogi(pname, param int)                          { defaultContext.Fogi(pname, param) }
+func Fogf(pname int, param float32)                  { defaultContext.Fogf(pname, param) }
+func Fogfv(pname int, value []float32)               { defaultContext.Fogfv(pname, value) }
+func FogCoordf(c float32)                            { defaultContext.FogCoordf(c) }
+func Scissor(x, y, width, height int)                { defaultContext.Scissor(x, y, width, height) }
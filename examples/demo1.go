@@ -30,6 +30,7 @@ func init() {
     sr.Viewport(width, height)                 // create an framebuffer for the render
     buffer = make([]byte, height*(width + 1))  // create an buffer for the terminal output
     sr.PolygonMode(sr.FRONT_AND_BACK, sr.FILL) // set line drawing mode
+    sr.Enable(sr.DEPTH_TEST)
 }
 
 func main() {
@@ -41,18 +42,18 @@ func main() {
         proj = sr.Frustum(left, right, bottom, top, near, far) // Set up perspective projection
     )
 
-    camPos := Vec3{0,0,7}
+    camPos := Vec3{0,0,1.4}
 
     view := sr.LookAt( camPos.x, camPos.y, camPos.z, 0, 0, 0)
     sr.SetCamera(proj, view)
     sr.ClearColor(0,0,0)
-    sr.Begin()
-        for v := 0; v < len(cube); v+=4 {
+    sr.ClearDepth(1)
+    sr.Begin(sr.TRIANGLES)
+        for v := 0; v < len(cube); v+=3 {
             sr.Color3f( 1.0, 0.0, 0.0)
             sr.Vertex3f(cube[v  ][0],cube[v  ][1],cube[v  ][2])
             sr.Vertex3f(cube[v+1][0],cube[v+1][1],cube[v+1][2])
             sr.Vertex3f(cube[v+2][0],cube[v+2][1],cube[v+2][2])
-            sr.Vertex3f(cube[v+3][0],cube[v+3][1],cube[v+3][2])
         }
     sr.End()
     
@@ -75,5 +76,4 @@ var cube = [][3]float32{
     {-0.5,-0.5,0.0},
     { 0.5,-0.5,0.0},
     { 0.0, 0.5,0.0},
-    { 0.0, 0.5,0.0}, // an extra vertice to draw an triangle
 }
@@ -30,6 +30,7 @@ func init() {
     sr.Viewport(width, height)                 // create an framebuffer for the render
     buffer = make([]byte, height*(width + 1))  // create an buffer for the terminal output
     sr.PolygonMode(sr.FRONT_AND_BACK, sr.LINE) // set line drawing mode
+    sr.Enable(sr.DEPTH_TEST)
 }
 
 func main() {
@@ -41,12 +42,13 @@ func main() {
         proj = sr.Frustum(left, right, bottom, top, near, far) // Set up perspective projection
     )
 
-    camPos := Vec3{6,8,10}
+    camPos := Vec3{1.5,2,2.5}
 
     view := sr.LookAt( camPos.x, camPos.y, camPos.z, 0, 0, 0)
     sr.SetCamera(proj, view)
     sr.ClearColor(0,0,0)
-    sr.Begin()
+    sr.ClearDepth(1)
+    sr.Begin(sr.QUADS)
         for v := 0; v < len(cube); v+=4 {
             sr.Color3f( 1.0, 0.0, 0.0)
             sr.Vertex3f(cube[v  ][0],cube[v  ][1],cube[v  ][2])
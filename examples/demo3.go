@@ -36,6 +36,7 @@ func init() {
     sr.Viewport(width, height)                 // create an framebuffer for the render
     buffer = make([]byte, height*(width + 1))  // create an buffer for the terminal output
     sr.PolygonMode(sr.FRONT_AND_BACK, sr.LINE) // set line drawing mode
+    sr.Enable(sr.DEPTH_TEST)
 }
 
 func main() {
@@ -48,14 +49,15 @@ func main() {
     )
 
 	for {
-        camPos := Vec3{7,7,7}
+        camPos := Vec3{1.75,1.75,1.75}
         view := sr.LookAt( camPos.x, camPos.y, camPos.z, 0, 0, 0)
         sr.SetCamera(proj, view)
         sr.ClearColor(0,0,0)
+        sr.ClearDepth(1)
 
         sr.Rotatef(float32(angleYaw), 0.1, 1.0, 0)
         angleYaw += 2.0
-        sr.Begin()
+        sr.Begin(sr.QUADS)
             for v := 0; v < len(sphere); v+=4 {
                 sr.Color3f( 1.0, 0, 0.0)
                 sr.Vertex3f(sphere[v  ][0],sphere[v  ][1],sphere[v  ][2])
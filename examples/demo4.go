@@ -41,6 +41,7 @@ var (
 func init() {
     sr.Viewport(width, height)                // create an framebuffer
     sr.PolygonMode(sr.FRONT_AND_BACK, sr.FILL)
+    sr.Enable(sr.DEPTH_TEST)
     buffer = make([]byte, height*(width + 1)) // create an buffer for the terminal output
 }
 
@@ -55,16 +56,17 @@ func main() {
     
 	for {
         
-		camPos := Vec3{ 20,20,20 }
+		camPos := Vec3{ 5,5,5 }
         
         view := sr.LookAt( camPos.x, camPos.y, camPos.z, 0, 1.0, 0)
         sr.SetCamera(proj, view)
         sr.ClearColor(0,0,0)
+        sr.ClearDepth(1)
         
         sr.Rotatef(float32(angle), 0.1, 1.0, 0)
         angle += 2.0
         
-        sr.Begin()
+        sr.Begin(sr.QUADS)
             for v := 0; v < len(teapot); v+=4 {
                 sr.Color3f( 0.1 + 0.1 * float32((v/4)%len(colors)), 0.0, 0.0)
                 sr.Vertex3f(teapot[v  ][0],teapot[v  ][1],teapot[v  ][2])
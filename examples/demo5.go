@@ -32,6 +32,7 @@ var (
 func init() {
     sr.Viewport(width, height)                // create an framebuffer
     sr.PolygonMode(sr.FRONT_AND_BACK, sr.FILL)
+    sr.Enable(sr.DEPTH_TEST)
     buffer = make([]byte, height*(width + 1)) // create an buffer for the terminal output
 }
 
@@ -45,23 +46,25 @@ func main() {
 	proj := sr.Frustum(left, right, bottom, top, near, far) // Set up perspective projection
     
     sr.Enable(sr.LIGHTING0)
-    sr.Lightfv(sr.LIGHTING0,sr.POSITION,[]float32{5.0, 0.0, 1.0, 1.0})
+    sr.Enable(sr.COLOR_MATERIAL)
+    sr.Lightfv(sr.LIGHTING0,sr.POSITION,[]float32{5.0, 0.0, 1.0, 0.0})
     sr.Lightfv(sr.LIGHTING0,sr.DIFFUSE, []float32{1.0, 1.0, 1.0})
     
 	for {
         start := time.Now()
         
-		camPos := Vec3{ 8,8,8 }
+		camPos := Vec3{ 2,2,2 }
         
         view := sr.LookAt( camPos.x, camPos.y, camPos.z, 0, 0, 0)
         sr.SetCamera(proj, view)
 
         sr.ClearColor(0,0,0)
+        sr.ClearDepth(1)
 
         sr.Rotatef(float32(angle),0.1,0.5,-0.1)
 		angle += 2
 
-        sr.Begin()
+        sr.Begin(sr.QUADS)
             for v := 0; v < len(suzanne); v+=4 {
                 sr.Color3f( 1, 1, 1)
                 sr.Vertex3f(suzanne[v  ][0],suzanne[v  ][1],suzanne[v  ][2])
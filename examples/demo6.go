@@ -29,6 +29,7 @@ const (
 func init() {
     sr.Viewport(width, height)                 // create an framebuffer for the render
     sr.PolygonMode(sr.FRONT_AND_BACK, sr.FILL) // set line drawing mode
+    sr.Enable(sr.DEPTH_TEST)
 }
 
 func main() {
@@ -40,8 +41,8 @@ func main() {
         proj = sr.Frustum(left, right, bottom, top, near, far) // Set up perspective projection
     )
 
-    //~ camPos := Vec3{6,8,10}
-    camPos := Vec3{6,5,6}
+    //~ camPos := Vec3{1.5,2,2.5}
+    camPos := Vec3{1.5,1.25,1.5}
 
     view := sr.LookAt( camPos.x, camPos.y, camPos.z, 0, 0, 0)
     sr.SetCamera(proj, view)
@@ -50,8 +51,9 @@ func main() {
         170.0/255.0,
         170.0/255.0,
     )
+    sr.ClearDepth(1)
     
-    sr.Begin()
+    sr.Begin(sr.QUADS)
     sr.Rotatef(110, 1.0, 0, 5.0)
         for v := 0; v < len(cube); v+=4 {
             //~ sr.Color3f( 1.0, 0.0, 0.0)
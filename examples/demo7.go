@@ -28,6 +28,7 @@ func init() {
     runtime.LockOSThread()
     sr.Viewport(width, height)                 // create an framebuffer for the render
     sr.PolygonMode(sr.FRONT_AND_BACK, sr.FILL) // set line drawing mode
+    sr.Enable(sr.DEPTH_TEST)
 }
 
 func main() {
@@ -55,31 +56,30 @@ func main() {
     rot := float32(0.0)
 
     sr.Enable (sr.LIGHTING0)
-    sr.Lightfv(sr.LIGHTING0,sr.POSITION,[]float32{6, 0, 10, 0.0})
+    sr.Enable (sr.COLOR_MATERIAL)
+    sr.Lightfv(sr.LIGHTING0,sr.POSITION,[]float32{6, 0, 10, 1.0})
     sr.Lightfv(sr.LIGHTING0,sr.DIFFUSE, []float32{1.0, 1.0, 1.0})
 
     //~ sr.Enable (sr.LIGHTING1)
-    //~ sr.Lightfv(sr.LIGHTING1,sr.POSITION,[]float32{-12.0, -16, -20, 0.0})
+    //~ sr.Lightfv(sr.LIGHTING1,sr.POSITION,[]float32{-12.0, -16, -20, 1.0})
     //~ sr.Lightfv(sr.LIGHTING1,sr.DIFFUSE, []float32{0.0, 1.0, 1.0})
     
     for !window.ShouldClose() {
 
         rot+= 3.0
-        camPos := Vec3{3, 4, 5}
+        camPos := Vec3{0.75, 1, 1.25}
         proj := sr.Frustum(left, right, bottom, top, near, far)
         view := sr.LookAt(camPos.x, camPos.y, camPos.z, 0, 0, 0)
 
         sr.SetCamera(proj, view)
         sr.ClearColor(0, 0, 0)
-        sr.Begin()
+        sr.ClearDepth(1)
+        sr.Begin(sr.QUADS)
         sr.Rotatef(rot, 0.0, 1.0, 0.1)
         sr.Translatef(0.0, -1.0, 0.0)
-        for v := 0; v < len(cube); v += 4 {
-            sr.Color3f (cube[v  ][3], cube[v  ][4], cube[v  ][5])
-            sr.Vertex3f(cube[  v][0], cube[v  ][1], cube[v  ][2])
-            sr.Vertex3f(cube[v+1][0], cube[v+1][1], cube[v+1][2])
-            sr.Vertex3f(cube[v+2][0], cube[v+2][1], cube[v+2][2])
-            sr.Vertex3f(cube[v+3][0], cube[v+3][1], cube[v+3][2])
+        for v := 0; v < len(cube); v++ {
+            sr.Color3f (cube[v][3], cube[v][4], cube[v][5])
+            sr.Vertex3f(cube[v][0], cube[v][1], cube[v][2])
         }
         sr.End()
         fb := sr.ReadPixels()
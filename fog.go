@@ -0,0 +1,120 @@
+package sr
+
+import "math"
+
+// fogState is the fog part of fragmentState.
+type fogState struct {
+    enabled   bool    // FOG
+    mode      int     // FOG_MODE, LINEAR, EXP or EXP2
+    density   float32 // FOG_DENSITY, for EXP and EXP2
+    start     float32 // FOG_START and FOG_END, for LINEAR
+    end       float32
+    color     SRColor // FOG_COLOR
+    source    int     // FOG_COORDINATE_SOURCE, FRAGMENT_DEPTH or FOG_COORDINATE
+    perVertex bool    // FOG_HINT is FASTEST, vertices carry the factor instead of the distance
+}
+
+var defaultFog = fogState{mode: EXP, density: 1, end: 1, source: FRAGMENT_DEPTH}
+
+// Fogi sets FOG_MODE, how fog grows with the distance c from the eye:
+//
+//     LINEAR        f = (FOG_END - c) / (FOG_END - FOG_START)
+//     EXP (default) f = exp(-FOG_DENSITY * c)
+//     EXP2          f = exp(-(FOG_DENSITY * c)^2)
+//
+// where a fragment keeps f of its color and takes 1 - f of FOG_COLOR,
+// f clamped to [0, 1], and LINEAR with FOG_START == FOG_END a step from
+// 1 to 0 at FOG_END. It also sets FOG_COORDINATE_SOURCE: c is the
+// eye-space depth of the fragment with FRAGMENT_DEPTH, the default, or
+// the coordinate given with FogCoordf with FOG_COORDINATE.
+// Hint(FOG_HINT, FASTEST) computes f at the vertices and interpolates
+// it, instead of computing it for every fragment.
+func (ctx *Context) Fogi(pname, param int) {
+    fog := &ctx.fragmentState.fog
+    switch {
+    case pname == FOG_MODE && (param == LINEAR || param == EXP || param == EXP2):
+        fog.mode = param
+    case pname == FOG_COORDINATE_SOURCE && (param == FRAGMENT_DEPTH || param == FOG_COORDINATE):
+        fog.source = param
+    default:
+        ctx.setError(INVALID_ENUM)
+    }
+}
+
+// Fogf sets FOG_DENSITY, which is at least 0, FOG_START or FOG_END.
+func (ctx *Context) Fogf(pname int, param float32) {
+    fog := &ctx.fragmentState.fog
+    switch pname {
+    case FOG_DENSITY:
+        if param < 0 {
+            ctx.setError(INVALID_VALUE)
+            return
+        }
+        fog.density = param
+    case FOG_START: fog.start = param
+    case FOG_END:   fog.end = param
+    default:        ctx.setError(INVALID_ENUM)
+    }
+}
+
+// Fogfv sets FOG_COLOR, as RGB or RGBA, or the parameters of Fogf. Fewer
+// values than the parameter takes record INVALID_VALUE.
+func (ctx *Context) Fogfv(pname int, value []float32) {
+    switch {
+    case pname == FOG_COLOR && len(value) >= 3: ctx.fragmentState.fog.color = colorv(value)
+    case pname != FOG_COLOR && len(value) >= 1: ctx.Fogf(pname, value[0])
+    default:                                    ctx.setError(INVALID_VALUE)
+    }
+}
+
+// FogCoordf sets the current fog coordinate, which each following
+// Vertex3f takes, the distance fog uses with FOG_COORDINATE_SOURCE
+// FOG_COORDINATE.
+func (ctx *Context) FogCoordf(c float32) {
+    ctx.fogCoord = c
+}
+
+// vertexFog returns the fog distance of v, at eye-space position eye, or
+// its fog factor when fog is computed per vertex.
+func (ctx *Context) vertexFog(v inputVertex, eye Vec4) float32 {
+    fog := &ctx.fragmentState.fog
+    c := float32(math.Abs(float64(eye.z / eye.w)))
+    if fog.source == FOG_COORDINATE {
+        c = v.fogCoord
+    }
+    if fog.perVertex {
+        return fog.factor(c)
+    }
+    return c
+}
+
+// factor returns the fraction f of a fragment's color left at distance c.
+func (fog *fogState) factor(c float32) float32 {
+    var f float64
+    switch fog.mode {
+    case LINEAR:
+        if fog.end == fog.start { // a step, rather than 0 / 0
+            if c < fog.end {
+                f = 1
+            }
+            break
+        }
+        f = float64((fog.end - c) / (fog.end - fog.start))
+    case EXP:    f = math.Exp(-float64(fog.density * c))
+    case EXP2:   f = math.Exp(-math.Pow(float64(fog.density*c), 2))
+    }
+    return float32(min(max(f, 0), 1))
+}
+
+// apply fogs the color c of a fragment with the interpolated vertex fog,
+// a distance or, computed per vertex, a factor. Alpha is kept.
+func (fog *fogState) apply(c SRColor, vertexFog float32) SRColor {
+    f := vertexFog
+    if !fog.perVertex {
+        f = fog.factor(vertexFog)
+    }
+    a := c.a
+    c = c.scale(f).add(fog.color.scale(1 - f))
+    c.a = a
+    return c
+}
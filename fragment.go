@@ -0,0 +1,217 @@
+package sr
+
+// fragmentState is the state the fragment stage runs with. Each primitive
+// keeps a copy of it from when it was emitted, so state changes never
+// affect primitives still waiting for the tiled rasterizer.
+type fragmentState struct {
+    alphaTest     bool
+    alphaFunc     int
+    alphaRef      float32
+    depthTest     bool
+    depthFunc     int
+    depthMask     bool
+    blend         bool
+    blendSrc      [2]int // source and destination factors, for RGB and alpha
+    blendDst      [2]int
+    blendEquation int
+    fog           fogState
+    scissorTest   bool
+    scissor       rect // Scissor box, y grows upwards from the bottom row
+}
+
+// fragment runs the per-fragment operations for pixel (x, y) at depth z
+// and writes the ones that pass.
+func (ctx *Context) fragment(p *primitive, x, y int, z float32, color SRColor) {
+    i := x + y*ctx.framebuffer.h
+    s := &p.state
+    if s.alphaTest && !compare(s.alphaFunc, color.a, s.alphaRef) {
+        return
+    }
+    if s.depthTest {
+        if !compare(s.depthFunc, z, ctx.zBuffer[i]) {
+            return
+        }
+        if s.depthMask {
+            ctx.zBuffer[i] = z
+        }
+    }
+    if s.blend {
+        color = s.blendColor(color, ctx.framebuffer.d[i])
+    }
+    ctx.framebuffer.d[i] = color
+}
+
+// blendColor combines an incoming color src with the stored one dst by
+// BlendFunc and BlendEquation.
+func (s *fragmentState) blendColor(src, dst SRColor) SRColor {
+    switch s.blendEquation {
+    case MIN: return SRColor{min(src.r, dst.r), min(src.g, dst.g), min(src.b, dst.b), min(src.a, dst.a)}
+    case MAX: return SRColor{max(src.r, dst.r), max(src.g, dst.g), max(src.b, dst.b), max(src.a, dst.a)}
+    }
+    fs, fd := blendFactor(s.blendSrc[0], src, dst), blendFactor(s.blendDst[0], src, dst)
+    fs.a, fd.a = blendFactor(s.blendSrc[1], src, dst).a, blendFactor(s.blendDst[1], src, dst).a
+    src, dst = src.mul(fs), dst.mul(fd)
+    switch s.blendEquation {
+    case FUNC_SUBTRACT:         return src.add(dst.scale(-1)).clamp()
+    case FUNC_REVERSE_SUBTRACT: return dst.add(src.scale(-1)).clamp()
+    }
+    return src.add(dst).clamp() // FUNC_ADD
+}
+
+// blendFactor returns the blend factor f for each component.
+func blendFactor(f int, src, dst SRColor) SRColor {
+    one := SRColor{1, 1, 1, 1}
+    switch f {
+    case ZERO:                return SRColor{}
+    case SRC_COLOR:           return src
+    case ONE_MINUS_SRC_COLOR: return one.add(src.scale(-1))
+    case DST_COLOR:           return dst
+    case ONE_MINUS_DST_COLOR: return one.add(dst.scale(-1))
+    case SRC_ALPHA:           return one.scale(src.a)
+    case ONE_MINUS_SRC_ALPHA: return one.scale(1 - src.a)
+    case DST_ALPHA:           return one.scale(dst.a)
+    case ONE_MINUS_DST_ALPHA: return one.scale(1 - dst.a)
+    case SRC_ALPHA_SATURATE:
+        f := min(src.a, 1-dst.a)
+        return SRColor{f, f, f, 1}
+    }
+    return one // ONE
+}
+
+// compare applies the comparison function fn (NEVER, LESS, ...) to an
+// incoming value and a stored one.
+func compare(fn int, incoming, stored float32) bool {
+    switch fn {
+    case NEVER:    return false
+    case LESS:     return incoming < stored
+    case EQUAL:    return incoming == stored
+    case LEQUAL:   return incoming <= stored
+    case GREATER:  return incoming > stored
+    case NOTEQUAL: return incoming != stored
+    case GEQUAL:   return incoming >= stored
+    }
+    return true // ALWAYS
+}
+
+// AlphaFunc selects the comparison between a fragment's alpha and ref,
+// clamped to [0, 1], that lets the fragment through when ALPHA_TEST is
+// enabled. Fragments it discards leave the depth buffer alone, so cut-out
+// textures need no sorting.
+func (ctx *Context) AlphaFunc(fn int, ref float32) {
+    switch fn {
+    case NEVER, LESS, EQUAL, LEQUAL, GREATER, NOTEQUAL, GEQUAL, ALWAYS:
+        ctx.fragmentState.alphaFunc = fn
+        ctx.fragmentState.alphaRef = min(max(ref, 0), 1)
+    default:
+        ctx.setError(INVALID_ENUM)
+    }
+}
+
+// DepthFunc selects the comparison between a fragment's depth and the
+// stored one that lets the fragment through when DEPTH_TEST is enabled.
+func (ctx *Context) DepthFunc(fn int) {
+    switch fn {
+    case NEVER, LESS, EQUAL, LEQUAL, GREATER, NOTEQUAL, GEQUAL, ALWAYS:
+        ctx.fragmentState.depthFunc = fn
+    default:
+        ctx.setError(INVALID_ENUM)
+    }
+}
+
+// BlendFunc sets the factors the incoming (source) and stored
+// (destination) colors are multiplied by before BlendEquation combines
+// them while BLEND is enabled: ZERO, ONE, SRC_COLOR, ONE_MINUS_SRC_COLOR,
+// DST_COLOR, ONE_MINUS_DST_COLOR, SRC_ALPHA, ONE_MINUS_SRC_ALPHA,
+// DST_ALPHA, ONE_MINUS_DST_ALPHA or, for the source only,
+// SRC_ALPHA_SATURATE. The defaults, ONE and ZERO, keep the incoming color.
+func (ctx *Context) BlendFunc(src, dst int) {
+    ctx.BlendFuncSeparate(src, dst, src, dst)
+}
+
+// BlendFuncSeparate is BlendFunc with factors for alpha apart from the
+// ones for RGB.
+func (ctx *Context) BlendFuncSeparate(srcRGB, dstRGB, srcAlpha, dstAlpha int) {
+    for _, f := range []int{srcRGB, dstRGB, srcAlpha, dstAlpha} {
+        switch f {
+        case ZERO, ONE, SRC_COLOR, ONE_MINUS_SRC_COLOR, DST_COLOR, ONE_MINUS_DST_COLOR,
+            SRC_ALPHA, ONE_MINUS_SRC_ALPHA, DST_ALPHA, ONE_MINUS_DST_ALPHA, SRC_ALPHA_SATURATE:
+        default:
+            ctx.setError(INVALID_ENUM)
+            return
+        }
+    }
+    if dstRGB == SRC_ALPHA_SATURATE || dstAlpha == SRC_ALPHA_SATURATE {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    ctx.fragmentState.blendSrc = [2]int{srcRGB, srcAlpha}
+    ctx.fragmentState.blendDst = [2]int{dstRGB, dstAlpha}
+}
+
+// BlendEquation selects how blending combines the weighted source S and
+// destination D: FUNC_ADD (the default) S + D, FUNC_SUBTRACT S - D,
+// FUNC_REVERSE_SUBTRACT D - S, or MIN and MAX, which take the smaller or
+// larger of the unweighted colors.
+func (ctx *Context) BlendEquation(mode int) {
+    switch mode {
+    case FUNC_ADD, FUNC_SUBTRACT, FUNC_REVERSE_SUBTRACT, MIN, MAX:
+        ctx.fragmentState.blendEquation = mode
+    default:
+        ctx.setError(INVALID_ENUM)
+    }
+}
+
+// DepthMask enables or disables writing to the depth buffer.
+func (ctx *Context) DepthMask(flag bool) {
+    ctx.fragmentState.depthMask = flag
+}
+
+// DepthRange maps normalized device z in [-1, 1] to window depth in
+// [near, far], both clamped to [0, 1].
+func (ctx *Context) DepthRange(near, far float32) {
+    ctx.depthNear = min(max(near, 0), 1)
+    ctx.depthFar = min(max(far, 0), 1)
+}
+
+// ClearDepth fills the depth buffer with d, clamped to [0, 1], within the
+// scissor box when SCISSOR_TEST is enabled.
+func (ctx *Context) ClearDepth(d float32) {
+    ctx.flush()
+    d = min(max(d, 0), 1)
+    r := ctx.clearRect()
+    for y := r.y0; y < r.y1; y++ {
+        for x := r.x0; x < r.x1; x++ {
+            ctx.zBuffer[x+y*ctx.framebuffer.h] = d
+        }
+    }
+}
+
+// Scissor sets the scissor box, the width by height pixels whose bottom
+// left corner is at (x, y), counted from the bottom left of the
+// framebuffer like OpenGL's window coordinates. While SCISSOR_TEST is
+// enabled, clears and primitives only touch pixels inside it. The box
+// starts out covering any framebuffer.
+func (ctx *Context) Scissor(x, y, width, height int) {
+    if width < 0 || height < 0 {
+        ctx.setError(INVALID_VALUE)
+        return
+    }
+    ctx.fragmentState.scissor = rect{x, y, x + width, y + height}
+}
+
+// scissorRect returns the pixels of the scissor box box, in framebuffer
+// rows, which grow downwards.
+func (ctx *Context) scissorRect(box rect) rect {
+    v := ctx.framebuffer.v
+    return rect{box.x0, v - box.y1, box.x1, v - box.y0}
+}
+
+// clearRect returns the pixels clears write: the whole framebuffer, cut
+// to the scissor box when SCISSOR_TEST is enabled.
+func (ctx *Context) clearRect() rect {
+    r := ctx.bounds()
+    if s := &ctx.fragmentState; s.scissorTest {
+        r = r.intersect(ctx.scissorRect(s.scissor))
+    }
+    return r
+}
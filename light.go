@@ -0,0 +1,363 @@
+package sr
+
+import "math"
+
+type Light struct {
+    Pos      Vec3    // Position (for point lights)
+    Dir      Vec3    // Direction (for directional lights)
+    Color    SRColor // RGB diffuse intensity
+    Ambient  SRColor
+    Specular SRColor
+    Type     int     // 0 = directional, 1 = point
+    enabled  bool
+
+    SpotDir      Vec3       // axis of the spot cone (point lights)
+    SpotCutoff   float32    // cone half-angle in degrees, 180 is no cone
+    SpotExponent float32    // falloff from the axis to the cone edge
+    Attenuation  [3]float32 // constant, linear and quadratic (point lights)
+}
+
+// defaultLight is the OpenGL initial state of every light but LIGHTING0,
+// which is also white.
+var defaultLight = Light{
+    Dir:         Vec3{0, 0, 1},
+    SpotDir:     Vec3{0, 0, -1},
+    SpotCutoff:  180,
+    Attenuation: [3]float32{1, 0, 0},
+}
+
+// material holds the reflectances of one face side, set with Materialfv.
+type material struct {
+    ambient   SRColor
+    diffuse   SRColor
+    specular  SRColor
+    emission  SRColor
+    shininess float32
+}
+
+// defaultMaterial is the OpenGL initial material.
+var defaultMaterial = material{
+    ambient: SRColor{0.2, 0.2, 0.2, 1},
+    diffuse: SRColor{0.8, 0.8, 0.8, 1},
+}
+
+// lightingState is what lighting a vertex reads. Primitives lit per pixel
+// keep a copy, taken when they are emitted.
+type lightingState struct {
+    lights           [8]Light
+    materials        [2]material // FRONT and BACK
+    sceneAmbient     SRColor     // LIGHT_MODEL_AMBIENT
+    colorMaterial    bool        // COLOR_MATERIAL
+    trackFace        int         // ColorMaterial face and mode
+    trackMode        int
+    localViewer      bool        // LIGHT_MODEL_LOCAL_VIEWER
+    twoSide          bool        // LIGHT_MODEL_TWO_SIDE
+    separateSpecular bool        // LIGHT_MODEL_COLOR_CONTROL is SEPARATE_SPECULAR_COLOR
+}
+
+// set sets the color term pname of m.
+func (m *material) set(pname int, c SRColor) {
+    switch pname {
+    case AMBIENT:             m.ambient = c
+    case DIFFUSE:             m.diffuse = c
+    case AMBIENT_AND_DIFFUSE: m.ambient, m.diffuse = c, c
+    case SPECULAR:            m.specular = c
+    case EMISSION:            m.emission = c
+    }
+}
+
+// faceMaterials returns the materials FRONT, BACK or FRONT_AND_BACK
+// names, or nil for another value.
+func (ctx *Context) faceMaterials(face int) []*material {
+    switch face {
+    case FRONT:          return []*material{&ctx.lighting.materials[0]}
+    case BACK:           return []*material{&ctx.lighting.materials[1]}
+    case FRONT_AND_BACK: return []*material{&ctx.lighting.materials[0], &ctx.lighting.materials[1]}
+    }
+    return nil
+}
+
+// Lightfv sets a light parameter. POSITION is (x, y, z, w) with w == 0 for
+// a directional light shining from (x, y, z); it and SPOT_DIRECTION are
+// carried to eye space by the modelview matrix current at the call, so a
+// light set after the camera stays put in the scene. With
+// LEGACY_LIGHT_POSITION enabled, they are taken as eye-space values as
+// they are, and w > 0.99 means directional, as in earlier versions.
+// Fewer values than the parameter takes record INVALID_VALUE.
+func (ctx *Context) Lightfv(id, attribute int, value []float32) {
+    var selectedLight *Light
+    switch id {
+    case LIGHTING0, LIGHTING1, LIGHTING2, LIGHTING3, LIGHTING4, LIGHTING5, LIGHTING6, LIGHTING7:
+        selectedLight = &ctx.lighting.lights[id-LIGHTING0]
+    default:
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    n := 0 // values attribute takes
+    switch attribute {
+    case POSITION:                                   n = 4
+    case DIFFUSE, AMBIENT, SPECULAR, SPOT_DIRECTION: n = 3
+    case SPOT_CUTOFF, SPOT_EXPONENT, CONSTANT_ATTENUATION, LINEAR_ATTENUATION, QUADRATIC_ATTENUATION: n = 1
+    }
+    if len(value) < n {
+        ctx.setError(INVALID_VALUE)
+        return
+    }
+    switch attribute {
+    case POSITION:
+        if ctx.legacyLights {
+            if value[3] > 0.99 {
+                selectedLight.Type = LIGHT_DIRECTIONAL
+                selectedLight.Dir = Vec3{value[0],value[1],value[2]}
+            } else {
+                selectedLight.Type = LIGHT_POINT
+                selectedLight.Pos = Vec3{value[0],value[1],value[2]}
+            }
+            break
+        }
+        p := transformVertex(Vec4{value[0], value[1], value[2], value[3]}, *ctx.topMatrix(MODELVIEW))
+        if value[3] == 0 {
+            selectedLight.Type = LIGHT_DIRECTIONAL
+            selectedLight.Dir = Vec3{p.x, p.y, p.z}
+        } else {
+            selectedLight.Type = LIGHT_POINT
+            selectedLight.Pos = Vec3{p.x / p.w, p.y / p.w, p.z / p.w}
+        }
+    case DIFFUSE:
+        selectedLight.Color = colorv(value)
+    case AMBIENT:
+        selectedLight.Ambient = colorv(value)
+    case SPECULAR:
+        selectedLight.Specular = colorv(value)
+    case SPOT_DIRECTION:
+        d := Vec4{value[0], value[1], value[2], 0}
+        if !ctx.legacyLights {
+            d = transformVertex(d, *ctx.topMatrix(MODELVIEW))
+        }
+        selectedLight.SpotDir = Vec3{d.x, d.y, d.z}
+    case SPOT_CUTOFF:
+        if (value[0] < 0 || value[0] > 90) && value[0] != 180 {
+            ctx.setError(INVALID_VALUE)
+            return
+        }
+        selectedLight.SpotCutoff = value[0]
+    case SPOT_EXPONENT:
+        if value[0] < 0 || value[0] > 128 {
+            ctx.setError(INVALID_VALUE)
+            return
+        }
+        selectedLight.SpotExponent = value[0]
+    case CONSTANT_ATTENUATION, LINEAR_ATTENUATION, QUADRATIC_ATTENUATION:
+        if value[0] < 0 {
+            ctx.setError(INVALID_VALUE)
+            return
+        }
+        selectedLight.Attenuation[attribute-CONSTANT_ATTENUATION] = value[0]
+    default:
+        ctx.setError(INVALID_ENUM)
+    }
+}
+
+// Materialfv sets a reflectance (AMBIENT, DIFFUSE, AMBIENT_AND_DIFFUSE,
+// SPECULAR or EMISSION, as RGB or RGBA) or the SHININESS exponent, in
+// [0, 128], of the FRONT, BACK or FRONT_AND_BACK material. The DIFFUSE
+// alpha is the alpha of lit vertices. Fewer values than the parameter
+// takes record INVALID_VALUE.
+func (ctx *Context) Materialfv(face, pname int, value []float32) {
+    faces := ctx.faceMaterials(face)
+    if faces == nil {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    switch pname {
+    case SHININESS:
+        if len(value) < 1 || value[0] < 0 || value[0] > 128 {
+            ctx.setError(INVALID_VALUE)
+            return
+        }
+        for _, m := range faces {
+            m.shininess = value[0]
+        }
+    case AMBIENT, DIFFUSE, AMBIENT_AND_DIFFUSE, SPECULAR, EMISSION:
+        if len(value) < 3 {
+            ctx.setError(INVALID_VALUE)
+            return
+        }
+        for _, m := range faces {
+            m.set(pname, colorv(value))
+        }
+    default:
+        ctx.setError(INVALID_ENUM)
+    }
+}
+
+// ColorMaterial selects the material term, AMBIENT, DIFFUSE,
+// AMBIENT_AND_DIFFUSE (the default), SPECULAR or EMISSION, of the FRONT,
+// BACK or FRONT_AND_BACK (the default) material that follows the current
+// color while COLOR_MATERIAL is enabled. Each vertex is then lit with its
+// own color in that term.
+func (ctx *Context) ColorMaterial(face, mode int) {
+    switch mode {
+    case AMBIENT, DIFFUSE, AMBIENT_AND_DIFFUSE, SPECULAR, EMISSION:
+    default:
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    if ctx.faceMaterials(face) == nil {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    ctx.lighting.trackFace, ctx.lighting.trackMode = face, mode
+    ctx.trackColor()
+}
+
+// trackColor copies the current color to the material term it drives,
+// if COLOR_MATERIAL is enabled, so it stays there once disabled.
+func (ctx *Context) trackColor() {
+    if !ctx.lighting.colorMaterial {
+        return
+    }
+    for _, m := range ctx.faceMaterials(ctx.lighting.trackFace) {
+        m.set(ctx.lighting.trackMode, ctx.submitC)
+    }
+}
+
+// LightModelfv sets LIGHT_MODEL_AMBIENT, the RGB ambient light of the
+// whole scene, which every vertex reflects while some light is enabled.
+// Fewer than three values record INVALID_VALUE.
+func (ctx *Context) LightModelfv(pname int, value []float32) {
+    switch {
+    case pname != LIGHT_MODEL_AMBIENT: ctx.setError(INVALID_ENUM)
+    case len(value) < 3:               ctx.setError(INVALID_VALUE)
+    default:                           ctx.lighting.sceneAmbient = colorv(value)
+    }
+}
+
+// LightModeli sets a lighting model parameter:
+//
+//   - LIGHT_MODEL_LOCAL_VIEWER nonzero computes specular highlights from
+//     the direction to the eye at each vertex instead of along -z, which
+//     is slower but exact up close.
+//   - LIGHT_MODEL_TWO_SIDE nonzero lights back-facing polygons with the
+//     BACK material and their normals flipped.
+//   - LIGHT_MODEL_COLOR_CONTROL SEPARATE_SPECULAR_COLOR keeps highlights
+//     in a secondary color added after texturing, so textures do not
+//     darken them; SINGLE_COLOR, the default, sums them into the color.
+func (ctx *Context) LightModeli(pname, param int) {
+    switch pname {
+    case LIGHT_MODEL_LOCAL_VIEWER: ctx.lighting.localViewer = param != 0
+    case LIGHT_MODEL_TWO_SIDE:     ctx.lighting.twoSide = param != 0
+    case LIGHT_MODEL_COLOR_CONTROL:
+        switch param {
+        case SINGLE_COLOR:            ctx.lighting.separateSpecular = false
+        case SEPARATE_SPECULAR_COLOR: ctx.lighting.separateSpecular = true
+        default:                      ctx.setError(INVALID_ENUM)
+        }
+    default:
+        ctx.setError(INVALID_ENUM)
+    }
+}
+
+// lightVertex returns the color and the secondary (specular) color of a
+// vertex at eye-space position eye with eye-space normal normal and
+// current color base, lit by the enabled lights with the OpenGL 1.x
+// equation:
+//
+//     emission + ambient*LIGHT_MODEL_AMBIENT + sum over lights of
+//         ambient*Ambient + diffuse*Color*max(N.L, 0) +
+//         specular*Specular*max(N.H, 0)^shininess
+//
+// where H is the half vector between L and the direction to the viewer.
+// The terms of a point light are scaled by its attenuation and spot cone.
+// back selects the BACK material and flips the normal. The secondary
+// color is black unless the specular term is kept apart. Alpha is the
+// diffuse alpha.
+func (lighting *lightingState) lightVertex(eye Vec4, normal Vec3, base SRColor, back bool) (SRColor, SRColor) {
+    m := lighting.materials[0]
+    if back {
+        m = lighting.materials[1]
+        normal = Vec3{-normal.x, -normal.y, -normal.z}
+    }
+    if lighting.colorMaterial && (lighting.trackFace == FRONT_AND_BACK || (lighting.trackFace == BACK) == back) {
+        m.set(lighting.trackMode, base)
+    }
+    total := m.emission.add(m.ambient.mul(lighting.sceneAmbient))
+    var highlights SRColor
+
+    enabledLights := false
+
+    viewer := Vec3{0, 0, 1} // infinite viewer looks down -z
+    if lighting.localViewer {
+        viewer = normalize(Vec3{-eye.x, -eye.y, -eye.z})
+    }
+
+    for _, light := range lighting.lights {
+        if !light.enabled {
+            continue
+        }
+        enabledLights = true
+
+        var L Vec3
+        factor := float32(1) // attenuation and spot cone
+
+        switch(light.Type) {
+        case LIGHT_DIRECTIONAL:
+            L = normalize(light.Dir)
+        case LIGHT_POINT:
+            L = Vec3{ // Light vector from vertex to light
+                light.Pos.x - eye.x,
+                light.Pos.y - eye.y,
+                light.Pos.z - eye.z,
+            }
+            d := float32(math.Sqrt(float64(dot(L, L))))
+            L = normalize(L)
+            k := light.Attenuation
+            if a := k[0] + k[1]*d + k[2]*d*d; a > 0 {
+                factor = 1 / a
+            }
+            factor *= light.spot(L)
+        default:
+            panic(1)
+        }
+        if factor == 0 {
+            continue
+        }
+
+        c := m.ambient.mul(light.Ambient)
+
+        diffuse := dot(normal, L)
+        if diffuse > 0 { // facing away gets neither diffuse nor highlight
+            c = c.add(m.diffuse.mul(light.Color).scale(diffuse))
+
+            H := normalize(Vec3{L.x + viewer.x, L.y + viewer.y, L.z + viewer.z})
+            if specular := dot(normal, H); specular > 0 {
+                f := float32(math.Pow(float64(specular), float64(m.shininess)))
+                highlights = highlights.add(m.specular.mul(light.Specular).scale(f * factor))
+            }
+        }
+        total = total.add(c.scale(factor))
+    }
+
+    if !enabledLights {
+        return base, SRColor{}
+    }
+    total.a, highlights.a = m.diffuse.a, 0
+    if !lighting.separateSpecular {
+        return total.add(highlights).clamp(), SRColor{}
+    }
+    return total.clamp(), highlights.clamp()
+}
+
+// spot returns how much of a point light reaches a vertex in direction L
+// from it: 1 without a cone, 0 outside it, and the cosine to the axis
+// raised to SpotExponent inside.
+func (light *Light) spot(L Vec3) float32 {
+    if light.SpotCutoff == 180 {
+        return 1
+    }
+    cos := -dot(L, normalize(light.SpotDir))
+    if cos < float32(math.Cos(float64(light.SpotCutoff)*PI/180)) {
+        return 0
+    }
+    return float32(math.Pow(float64(cos), float64(light.SpotExponent)))
+}
@@ -0,0 +1,155 @@
+package sr
+
+import "math"
+
+var identity = [16]float32{
+    1, 0, 0, 0,
+    0, 1, 0, 0,
+    0, 0, 1, 0,
+    0, 0, 0, 1,
+}
+
+// Maximum depth of each matrix stack, the minimums OpenGL requires.
+var matrixStackDepth = [2 + maxTextureUnits]int{32, 2, 2, 2, 2, 2}
+
+// matrixIndex returns the stack of mode in matrixStacks. Each texture
+// unit has its own TEXTURE stack, the one of the active unit is chosen.
+func (ctx *Context) matrixIndex(mode int) int {
+    switch mode {
+    case PROJECTION: return 1
+    case TEXTURE:    return 2 + ctx.activeTexture
+    }
+    return 0
+}
+
+// MatrixMode selects the stack that PushMatrix, PopMatrix, LoadIdentity,
+// LoadMatrixf, MultMatrixf, Translatef, Rotatef and Scalef operate on.
+func (ctx *Context) MatrixMode(mode int) {
+    switch mode {
+    case MODELVIEW, PROJECTION, TEXTURE:
+        ctx.matrixMode = mode
+    default:
+        ctx.setError(INVALID_ENUM)
+    }
+}
+
+// PushMatrix duplicates the top of the current stack. A full stack is left
+// unchanged and records STACK_OVERFLOW.
+func (ctx *Context) PushMatrix() {
+    i := ctx.matrixIndex(ctx.matrixMode)
+    stack := ctx.matrixStacks[i]
+    if len(stack) >= matrixStackDepth[i] {
+        ctx.setError(STACK_OVERFLOW)
+        return
+    }
+    ctx.matrixStacks[i] = append(stack, stack[len(stack)-1])
+}
+
+// PopMatrix discards the top of the current stack. Popping the last matrix
+// is ignored and records STACK_UNDERFLOW.
+func (ctx *Context) PopMatrix() {
+    i := ctx.matrixIndex(ctx.matrixMode)
+    stack := ctx.matrixStacks[i]
+    if len(stack) == 1 {
+        ctx.setError(STACK_UNDERFLOW)
+        return
+    }
+    ctx.matrixStacks[i] = stack[:len(stack)-1]
+}
+
+func (ctx *Context) LoadIdentity() {
+    *ctx.currentMatrix() = identity
+}
+
+// LoadMatrixf replaces the top of the current stack with the column-major
+// matrix m.
+func (ctx *Context) LoadMatrixf(m [16]float32) {
+    *ctx.currentMatrix() = m
+}
+
+// MultMatrixf multiplies the top of the current stack by the column-major
+// matrix m, on the right.
+func (ctx *Context) MultMatrixf(m [16]float32) {
+    top := ctx.currentMatrix()
+    *top = multMatrix(*top, m)
+}
+
+func (ctx *Context) currentMatrix() *[16]float32 {
+    return ctx.topMatrix(ctx.matrixMode)
+}
+
+func (ctx *Context) topMatrix(mode int) *[16]float32 {
+    stack := ctx.matrixStacks[ctx.matrixIndex(mode)]
+    return &stack[len(stack)-1]
+}
+
+// transform carries an object-space vertex to eye and clip space.
+func (ctx *Context) transform(v Vec4) (eye, clip Vec4) {
+    eye = transformVertex(v, *ctx.topMatrix(MODELVIEW))
+    clip = transformVertex(eye, *ctx.topMatrix(PROJECTION))
+    return
+}
+
+// normalMatrix returns the inverse transpose of the upper-left 3x3 of m,
+// column-major, which carries normals to the space m carries points to.
+func normalMatrix(m [16]float32) [9]float32 {
+    a := func(row, col int) float32 {
+        return m[(col%3)*4+row%3]
+    }
+    var n [9]float32
+    for row := 0; row < 3; row++ {
+        for col := 0; col < 3; col++ { // cofactors, the sign comes from the cyclic order
+            n[col*3+row] = a(row+1, col+1)*a(row+2, col+2) - a(row+1, col+2)*a(row+2, col+1)
+        }
+    }
+    det := a(0, 0)*n[0] + a(0, 1)*n[3] + a(0, 2)*n[6]
+    for i := range n {
+        n[i] /= det
+    }
+    return n
+}
+
+// invertMatrix returns the inverse of the column-major matrix m, by
+// Gauss-Jordan elimination with partial pivoting.
+func invertMatrix(m [16]float32) [16]float32 {
+    var a [4][8]float64 // the rows of m beside those of the identity
+    for row := 0; row < 4; row++ {
+        for col := 0; col < 4; col++ {
+            a[row][col] = float64(m[col*4+row])
+        }
+        a[row][4+row] = 1
+    }
+    for col := 0; col < 4; col++ {
+        pivot := col
+        for row := col + 1; row < 4; row++ {
+            if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+                pivot = row
+            }
+        }
+        a[col], a[pivot] = a[pivot], a[col]
+        for row := 0; row < 4; row++ {
+            if row == col {
+                continue
+            }
+            f := a[row][col] / a[col][col]
+            for k := col; k < 8; k++ {
+                a[row][k] -= f * a[col][k]
+            }
+        }
+    }
+    var inv [16]float32
+    for row := 0; row < 4; row++ {
+        for col := 0; col < 4; col++ {
+            inv[col*4+row] = float32(a[row][4+col] / a[row][row])
+        }
+    }
+    return inv
+}
+
+func transformNormal(n [9]float32, v Vec3) Vec3 {
+    return Vec3{
+        v.x*n[0] + v.y*n[3] + v.z*n[6],
+        v.x*n[1] + v.y*n[4] + v.z*n[7],
+        v.x*n[2] + v.y*n[5] + v.z*n[8],
+    }
+}
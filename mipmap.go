@@ -0,0 +1,81 @@
+package sr
+
+import "math"
+
+// GenerateMipmap builds the mipmap levels of the bound texture from its
+// base level, each half the size of the one before, down to 1x1. They are
+// box filtered, or Lanczos filtered, sharper but slower, after
+// Hint(GENERATE_MIPMAP_HINT, NICEST).
+func (ctx *Context) GenerateMipmap(target int) {
+    if target != TEXTURE_2D {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    t := ctx.boundTexture()
+    if !t.complete() {
+        ctx.setError(INVALID_OPERATION)
+        return
+    }
+    ctx.generateMipmap(t)
+}
+
+// mipFilter is a downsampling kernel over distances in destination texels.
+type mipFilter struct {
+    radius float64
+    weight func(x float64) float64
+}
+
+var boxFilter = mipFilter{0.5, func(x float64) float64 { return 1 }}
+
+var lanczosFilter = mipFilter{2, func(x float64) float64 { // Lanczos with a = 2
+    if x == 0 {
+        return 1
+    }
+    px := math.Pi * x
+    return 2 * math.Sin(px) * math.Sin(px/2) / (px * px)
+}}
+
+func (ctx *Context) generateMipmap(t *texture) {
+    filter := boxFilter
+    if ctx.mipmapHint == NICEST {
+        filter = lanczosFilter
+    }
+    t.levels = t.levels[:1]
+    for img := t.levels[0]; img.w > 1 || img.h > 1; {
+        img = downsample(img, filter)
+        t.levels = append(t.levels, img)
+    }
+}
+
+// downsample halves img, rounding down to at least 1, one axis at a time.
+func downsample(img texImage, filter mipFilter) texImage {
+    w, h := max(img.w/2, 1), max(img.h/2, 1)
+    rows := texImage{w, img.h, make([]SRColor, w*img.h)}
+    for y := 0; y < img.h; y++ {
+        resample(img.texels[y*img.w:], 1, img.w, rows.texels[y*w:], 1, w, filter)
+    }
+    out := texImage{w, h, make([]SRColor, w*h)}
+    for x := 0; x < w; x++ {
+        resample(rows.texels[x:], w, img.h, out.texels[x:], w, h, filter)
+    }
+    return out
+}
+
+// resample filters the n texels of src, stride apart, into the m texels
+// of dst, dstStride apart. Texels past the ends repeat the edge ones.
+func resample(src []SRColor, stride, n int, dst []SRColor, dstStride, m int, filter mipFilter) {
+    scale := float64(n) / float64(m)
+    for i := 0; i < m; i++ {
+        center := (float64(i) + 0.5) * scale // in source texels
+        j0 := int(math.Ceil(center - filter.radius*scale - 0.5))
+        j1 := int(math.Floor(center + filter.radius*scale - 0.5))
+        var c SRColor
+        var sum float64
+        for j := j0; j <= j1; j++ {
+            w := filter.weight((float64(j) + 0.5 - center) / scale)
+            c = c.add(src[min(max(j, 0), n-1)*stride].scale(float32(w)))
+            sum += w
+        }
+        dst[i*dstStride] = c.scale(float32(1 / sum)).clamp()
+    }
+}
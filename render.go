@@ -5,7 +5,33 @@ import "math"
 const PI = 3.1415926535897932384626433832795028841971693993751058209749445923078164062
 
 type SRColor struct {
-    r, g, b float32
+    r, g, b, a float32
+}
+
+// colorv returns the color (r, g, b) or (r, g, b, a) in value, with alpha
+// 1 when it is left out.
+func colorv(value []float32) SRColor {
+    c := SRColor{value[0], value[1], value[2], 1}
+    if len(value) > 3 {
+        c.a = value[3]
+    }
+    return c
+}
+
+func (c SRColor) add(o SRColor) SRColor {
+    return SRColor{c.r + o.r, c.g + o.g, c.b + o.b, c.a + o.a}
+}
+
+func (c SRColor) scale(f float32) SRColor {
+    return SRColor{c.r * f, c.g * f, c.b * f, c.a * f}
+}
+
+func (c SRColor) mul(o SRColor) SRColor {
+    return SRColor{c.r * o.r, c.g * o.g, c.b * o.b, c.a * o.a}
+}
+
+func (c SRColor) clamp() SRColor {
+    return SRColor{min(max(c.r, 0), 1), min(max(c.g, 0), 1), min(max(c.b, 0), 1), min(max(c.a, 0), 1)}
 }
 
 type IVec2 struct {
@@ -16,13 +42,24 @@ type Vec3 struct {
 	x, y, z float32
 }
 
+func (v Vec3) add(o Vec3) Vec3 {
+    return Vec3{v.x + o.x, v.y + o.y, v.z + o.z}
+}
+
+func (v Vec3) scale(f float32) Vec3 {
+    return Vec3{v.x * f, v.y * f, v.z * f}
+}
+
 type Vec4 struct {
     x, y, z, w float32
 }
 
-type Quad struct {
-    v [4]Vec4
-    c SRColor
+func (v Vec4) add(o Vec4) Vec4 {
+    return Vec4{v.x + o.x, v.y + o.y, v.z + o.z, v.w + o.w}
+}
+
+func (v Vec4) scale(f float32) Vec4 {
+    return Vec4{v.x * f, v.y * f, v.z * f, v.w * f}
 }
 
 type Framebuffer struct {
@@ -30,14 +67,6 @@ type Framebuffer struct {
     d    []SRColor
 }
 
-type Light struct {
-    Pos  Vec3    // Position (for point lights)
-    Dir  Vec3    // Direction (for directional lights)
-    Color SRColor  // RGB intensity
-    Type  int    // 0 = directional, 1 = point
-    enabled bool
-}
-
 const (
     LIGHT_DIRECTIONAL = iota
     LIGHT_POINT
@@ -54,224 +83,638 @@ const (
     LIGHTING1
     LIGHTING2
     LIGHTING3
+    LIGHTING4
+    LIGHTING5
+    LIGHTING6
+    LIGHTING7
     
     POSITION
     DIFFUSE
+    AMBIENT
+    SPECULAR
+    AMBIENT_AND_DIFFUSE
+    EMISSION
+    SHININESS
+    SPOT_DIRECTION
+    SPOT_CUTOFF
+    SPOT_EXPONENT
+    CONSTANT_ATTENUATION
+    LINEAR_ATTENUATION
+    QUADRATIC_ATTENUATION
+    
+    LIGHT_MODEL_LOCAL_VIEWER
+    LIGHT_MODEL_AMBIENT
+    LIGHT_MODEL_TWO_SIDE
+    LIGHT_MODEL_COLOR_CONTROL
+    SINGLE_COLOR
+    SEPARATE_SPECULAR_COLOR
+    
+    POINTS
+    LINES
+    LINE_LOOP
+    LINE_STRIP
+    TRIANGLES
+    TRIANGLE_STRIP
+    TRIANGLE_FAN
+    QUADS
+    QUAD_STRIP
+    POLYGON
+    
+    MODELVIEW
+    PROJECTION
+    TEXTURE
+    
+    DEPTH_TEST
+    
+    NEVER
+    LESS
+    EQUAL
+    LEQUAL
+    GREATER
+    NOTEQUAL
+    GEQUAL
+    ALWAYS
+    
+    CULL_FACE
+    CW
+    CCW
+    
+    FLAT
+    SMOOTH
+    PHONG
+    
+    NORMALIZE
+    
+    LEGACY_LIGHT_POSITION
+    
+    COLOR_MATERIAL
+    
+    TEXTURE_2D
+    RGB
+    TEXTURE_MIN_FILTER
+    TEXTURE_MAG_FILTER
+    TEXTURE_WRAP_S
+    TEXTURE_WRAP_T
+    NEAREST
+    LINEAR
+    REPEAT
+    CLAMP
+    MIRRORED_REPEAT
+    NEAREST_MIPMAP_NEAREST
+    LINEAR_MIPMAP_NEAREST
+    NEAREST_MIPMAP_LINEAR
+    LINEAR_MIPMAP_LINEAR
+    GENERATE_MIPMAP
+    TEXTURE_MAX_ANISOTROPY
+    GENERATE_MIPMAP_HINT
+    FASTEST
+    NICEST
+    DONT_CARE
+    TEXTURE_ENV
+    TEXTURE_ENV_MODE
+    TEXTURE_ENV_COLOR
+    MODULATE
+    REPLACE
+    DECAL
+    BLEND
+    ADD
+    S
+    T
+    R
+    Q
+    TEXTURE_GEN_MODE
+    OBJECT_PLANE
+    EYE_PLANE
+    OBJECT_LINEAR
+    EYE_LINEAR
+    SPHERE_MAP
+    REFLECTION_MAP
+    TEXTURE_GEN_S
+    TEXTURE_GEN_T
+    TEXTURE_GEN_R
+    TEXTURE_GEN_Q
+    TEXTURE0
+    TEXTURE1
+    TEXTURE2
+    TEXTURE3
+    RGBA
+    ZERO
+    ONE
+    SRC_COLOR
+    ONE_MINUS_SRC_COLOR
+    DST_COLOR
+    ONE_MINUS_DST_COLOR
+    SRC_ALPHA
+    ONE_MINUS_SRC_ALPHA
+    DST_ALPHA
+    ONE_MINUS_DST_ALPHA
+    SRC_ALPHA_SATURATE
+    FUNC_ADD
+    FUNC_SUBTRACT
+    FUNC_REVERSE_SUBTRACT
+    MIN
+    MAX
+    ALPHA_TEST
+    FOG
+    FOG_MODE
+    FOG_DENSITY
+    FOG_START
+    FOG_END
+    FOG_COLOR
+    EXP
+    EXP2
+    FOG_COORDINATE_SOURCE
+    FOG_COORDINATE
+    FRAGMENT_DEPTH
+    FOG_HINT
+    SCISSOR_TEST
 )
 
-var (
-    framebuffer Framebuffer
-    zBuffer         []float32
-    MatrixModelView [16]float32
-    Submit  Quad
-    SubmitI int
-    SubmitC SRColor
+const (
+    NO_ERROR = iota
+    INVALID_ENUM
+    INVALID_VALUE
+    INVALID_OPERATION
+    STACK_OVERFLOW
+    STACK_UNDERFLOW
+)
+
+// Context owns all renderer state: the framebuffer, the depth buffer, the
+// matrix stacks, the primitive being assembled and the lights. Each Context
+// renders independently, so separate goroutines can each drive their own.
+type Context struct {
+    framebuffer      Framebuffer
+    zBuffer          []float32
+    matrixMode       int              // stack changed by the matrix functions
+    matrixStacks     [2 + maxTextureUnits][][16]float32 // MODELVIEW, PROJECTION and a TEXTURE stack per unit
+    err              int              // first error since the last GetError
+    inBegin          bool
+    mode             int    // primitive mode given to Begin
+    verts            []inputVertex // vertices of the primitive being assembled
+    stripOdd         bool   // next TRIANGLE_STRIP triangle has swapped winding
+    submitC          SRColor // current color
+    normal           Vec3    // current normal
+    hasNormal        bool    // Normal3f was called, else faces use their own normal
+    normalize        bool    // NORMALIZE
+    shadeModel       int     // FLAT or SMOOTH
     polygonModeFront int
     polygonModeBack  int
-    Lights = [4]Light{}
-    lastVertex  *IVec2
-)
+    frontFace        int  // winding of front faces, CW or CCW
+    cullFace         int  // faces culled when cullFaceEnabled
+    cullFaceEnabled  bool
+    lighting         lightingState // lights, materials and light model
+    legacyLights     bool          // LEGACY_LIGHT_POSITION
+    textures         map[int]*texture // texture objects by name
+    nextTexture      int              // last name GenTextures returned
+    units            [maxTextureUnits]textureUnit
+    activeTexture    int              // ActiveTexture, the unit texture state calls change
+    mipmapHint       int              // GENERATE_MIPMAP_HINT
+    fogCoord         float32          // current fog coordinate
+    fragmentState    fragmentState
+    depthNear        float32 // DepthRange
+    depthFar         float32
+    workers          int         // rasterizer goroutines, 1 draws immediately
+    prims            []primitive // primitives waiting for the tiled rasterizer
+}
 
-func Viewport(h, v int) {
-    framebuffer = Framebuffer{
+func NewContext() *Context {
+    ctx := &Context{
+        workers:          1,
+        matrixMode:       MODELVIEW,
+        polygonModeFront: FILL,
+        polygonModeBack:  FILL,
+        frontFace:        CCW,
+        cullFace:         BACK,
+        shadeModel:       SMOOTH,
+        depthFar:         1,
+        fragmentState: fragmentState{
+            alphaFunc:     ALWAYS,
+            depthFunc:     LESS,
+            depthMask:     true,
+            blendSrc:      [2]int{ONE, ONE},
+            blendDst:      [2]int{ZERO, ZERO},
+            blendEquation: FUNC_ADD,
+            fog:           defaultFog,
+            scissor:       rect{0, 0, math.MaxInt, math.MaxInt},
+        },
+    }
+    for i := range ctx.matrixStacks {
+        ctx.matrixStacks[i] = [][16]float32{identity}
+    }
+    ctx.lighting.materials = [2]material{defaultMaterial, defaultMaterial}
+    ctx.submitC = SRColor{0, 0, 0, 1}
+    ctx.lighting.sceneAmbient = SRColor{0.2, 0.2, 0.2, 1}
+    ctx.lighting.trackFace, ctx.lighting.trackMode = FRONT_AND_BACK, AMBIENT_AND_DIFFUSE
+    ctx.textures = map[int]*texture{0: newTexture()}
+    ctx.mipmapHint = DONT_CARE
+    for i := range ctx.units {
+        ctx.units[i] = defaultTextureUnit
+    }
+    for i := range ctx.lighting.lights {
+        ctx.lighting.lights[i] = defaultLight
+    }
+    ctx.lighting.lights[0].Color = SRColor{1, 1, 1, 1} // LIGHTING0 starts white, the others black
+    ctx.lighting.lights[0].Specular = SRColor{1, 1, 1, 1}
+    return ctx
+}
+
+// GetError returns the first error recorded since the last call, and
+// clears it.
+func (ctx *Context) GetError() int {
+    err := ctx.err
+    ctx.err = NO_ERROR
+    return err
+}
+
+func (ctx *Context) setError(err int) {
+    if ctx.err == NO_ERROR {
+        ctx.err = err
+    }
+}
+
+func (ctx *Context) Viewport(h, v int) {
+    ctx.prims = ctx.prims[:0]
+    ctx.framebuffer = Framebuffer{
         h: h,
         v: v,
         d: make([]SRColor, h*v),
     }
-    zBuffer = make([]float32, h*v)
+    ctx.zBuffer = make([]float32, h*v)
+    for i := range ctx.zBuffer {
+        ctx.zBuffer[i] = 1
+    }
 }
 
-func XY() (int,int) {
-    return framebuffer.h, framebuffer.v
+func (ctx *Context) XY() (int,int) {
+    return ctx.framebuffer.h, ctx.framebuffer.v
 }
 
-func PolygonMode(face, mode int) {
+func (ctx *Context) bounds() rect {
+    return rect{0, 0, ctx.framebuffer.h, ctx.framebuffer.v}
+}
+
+func (ctx *Context) PolygonMode(face, mode int) {
     switch face {
-    case FRONT: polygonModeFront = mode
-    case BACK:  polygonModeBack = mode
+    case FRONT: ctx.polygonModeFront = mode
+    case BACK:  ctx.polygonModeBack = mode
     case FRONT_AND_BACK:
-        polygonModeFront = mode
-        polygonModeBack = mode
+        ctx.polygonModeFront = mode
+        ctx.polygonModeBack = mode
+    }
+}
+
+// FrontFace sets the window-space winding, CW or CCW, of front-facing
+// polygons.
+func (ctx *Context) FrontFace(mode int) {
+    switch mode {
+    case CW, CCW: ctx.frontFace = mode
+    default:      ctx.setError(INVALID_ENUM)
     }
 }
 
-func Enable(v int) {
+// CullFace selects the faces, FRONT, BACK or FRONT_AND_BACK, that are
+// discarded when CULL_FACE is enabled.
+func (ctx *Context) CullFace(mode int) {
+    switch mode {
+    case FRONT, BACK, FRONT_AND_BACK: ctx.cullFace = mode
+    default:                          ctx.setError(INVALID_ENUM)
+    }
+}
+
+func (ctx *Context) Enable(v int) {
     switch v {
-    case LIGHTING0: Lights[0].enabled = true
-    case LIGHTING1: Lights[1].enabled = true
-    case LIGHTING2: Lights[2].enabled = true
-    case LIGHTING3: Lights[3].enabled = true
+    case CULL_FACE:  ctx.cullFaceEnabled = true
+    case NORMALIZE:  ctx.normalize = true
+    case DEPTH_TEST: ctx.fragmentState.depthTest = true
+    case BLEND:      ctx.fragmentState.blend = true
+    case ALPHA_TEST: ctx.fragmentState.alphaTest = true
+    case FOG:        ctx.fragmentState.fog.enabled = true
+    case SCISSOR_TEST:
+        ctx.fragmentState.scissorTest = true
+    case LEGACY_LIGHT_POSITION:
+        ctx.legacyLights = true
+    case COLOR_MATERIAL:
+        ctx.lighting.colorMaterial = true
+        ctx.trackColor()
+    case TEXTURE_2D: ctx.unit().texture2D = true
+    case TEXTURE_GEN_S, TEXTURE_GEN_T, TEXTURE_GEN_R, TEXTURE_GEN_Q:
+        ctx.unit().texGens[v-TEXTURE_GEN_S].enabled = true
+    case LIGHTING0, LIGHTING1, LIGHTING2, LIGHTING3, LIGHTING4, LIGHTING5, LIGHTING6, LIGHTING7:
+        ctx.lighting.lights[v-LIGHTING0].enabled = true
     }
 }
 
-func Disable(v int) {
+func (ctx *Context) Disable(v int) {
     switch v {
-    case LIGHTING0: Lights[0].enabled = false
-    case LIGHTING1: Lights[1].enabled = false
-    case LIGHTING2: Lights[2].enabled = false
-    case LIGHTING3: Lights[3].enabled = false
-    }
-}
-
-func Lightfv(id, attribute int, value []float32) {
-    var selectedLight *Light
-    switch id {
-    case LIGHTING0: selectedLight = &Lights[0]
-    case LIGHTING1: selectedLight = &Lights[1]
-    case LIGHTING2: selectedLight = &Lights[2]
-    case LIGHTING3: selectedLight = &Lights[3]
-    default: panic("Invalid light ID")
-    }
-    switch attribute {
-    case POSITION:
-        if value[3] > 0.99 {
-            selectedLight.Type = LIGHT_DIRECTIONAL
-            selectedLight.Dir = Vec3{value[0],value[1],value[2]}
-        } else {
-            selectedLight.Type = LIGHT_POINT
-            selectedLight.Pos = Vec3{value[0],value[1],value[2]}
-        }
-    case DIFFUSE:
-        selectedLight.Color = SRColor{value[0],value[1],value[2]}
-    default:
-        panic("Invalid light attribute")
+    case CULL_FACE:  ctx.cullFaceEnabled = false
+    case NORMALIZE:  ctx.normalize = false
+    case DEPTH_TEST: ctx.fragmentState.depthTest = false
+    case BLEND:      ctx.fragmentState.blend = false
+    case ALPHA_TEST: ctx.fragmentState.alphaTest = false
+    case FOG:        ctx.fragmentState.fog.enabled = false
+    case SCISSOR_TEST:
+        ctx.fragmentState.scissorTest = false
+    case LEGACY_LIGHT_POSITION:
+        ctx.legacyLights = false
+    case COLOR_MATERIAL:
+        ctx.lighting.colorMaterial = false
+    case TEXTURE_2D: ctx.unit().texture2D = false
+    case TEXTURE_GEN_S, TEXTURE_GEN_T, TEXTURE_GEN_R, TEXTURE_GEN_Q:
+        ctx.unit().texGens[v-TEXTURE_GEN_S].enabled = false
+    case LIGHTING0, LIGHTING1, LIGHTING2, LIGHTING3, LIGHTING4, LIGHTING5, LIGHTING6, LIGHTING7:
+        ctx.lighting.lights[v-LIGHTING0].enabled = false
     }
 }
 
-func Vertex3f(x, y, z float32) {
-    Submit.v[SubmitI] = Vec4{x, y, z, 1}
+// Hint sets GENERATE_MIPMAP_HINT or FOG_HINT to FASTEST, NICEST or
+// DONT_CARE.
+func (ctx *Context) Hint(target, mode int) {
+    if mode != FASTEST && mode != NICEST && mode != DONT_CARE {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    switch target {
+    case GENERATE_MIPMAP_HINT: ctx.mipmapHint = mode
+    case FOG_HINT:             ctx.fragmentState.fog.perVertex = mode == FASTEST
+    default:                   ctx.setError(INVALID_ENUM)
+    }
+}
 
-    if SubmitI++; SubmitI < 4 { // Wait until we have 4 vertices
+// Vertex3f adds a vertex to the primitive started by Begin, with the
+// current color, normal and texture coordinates. Primitives are drawn as
+// soon as their last vertex arrives; vertices outside Begin/End are
+// ignored.
+func (ctx *Context) Vertex3f(x, y, z float32) {
+    if !ctx.inBegin {
         return
     }
+    v := inputVertex{
+        pos:       Vec4{x, y, z, 1},
+        color:     ctx.submitC,
+        normal:    ctx.normal,
+        hasNormal: ctx.hasNormal,
+        fogCoord:  ctx.fogCoord,
+    }
+    for u := range ctx.units {
+        v.texCoords[u] = ctx.units[u].texCoord
+    }
+    ctx.verts = append(ctx.verts, v)
+    vs := ctx.verts
+    n := len(vs)
 
-    Submit.c = SubmitC
-    quad := Submit
+    // The last argument to polygon is the provoking vertex, whose color
+    // a FLAT shaded primitive takes.
+    switch ctx.mode {
+    case POINTS:
+        ctx.point(vs[0])
+        ctx.verts = vs[:0]
+    case LINES:
+        if n == 2 {
+            ctx.line(vs[0], vs[1])
+            ctx.verts = vs[:0]
+        }
+    case LINE_STRIP, LINE_LOOP: // keep the first vertex to close the loop, and the last one
+        if n >= 2 {
+            ctx.line(vs[n-2], vs[n-1])
+        }
+        if n == 3 {
+            ctx.verts = append(vs[:1], vs[2])
+        }
+    case TRIANGLES:
+        if n == 3 {
+            ctx.polygon(vs, 2)
+            ctx.verts = vs[:0]
+        }
+    case TRIANGLE_STRIP:
+        if n == 3 {
+            if ctx.stripOdd { // every other triangle is swapped to keep the winding
+                ctx.polygon([]inputVertex{vs[1], vs[0], vs[2]}, 2)
+            } else {
+                ctx.polygon(vs, 2)
+            }
+            ctx.stripOdd = !ctx.stripOdd
+            ctx.verts = append(vs[:0], vs[1], vs[2])
+        }
+    case TRIANGLE_FAN:
+        if n == 3 {
+            ctx.polygon(vs, 2)
+            ctx.verts = append(vs[:1], vs[2])
+        }
+    case QUADS:
+        if n == 4 {
+            ctx.polygon(vs, 3)
+            ctx.verts = vs[:0]
+        }
+    case QUAD_STRIP:
+        if n == 4 {
+            ctx.polygon([]inputVertex{vs[0], vs[1], vs[3], vs[2]}, 2)
+            ctx.verts = append(vs[:0], vs[2], vs[3])
+        }
+    case POLYGON: // drawn by End
+    }
+}
 
-    var sx [4]int
-    var sy [4]int
-    var transformedVerts [4]Vec4
+// polygon lights, transforms and rasterizes a convex polygon with at least
+// three vertices in object space. Lighting happens per vertex in eye
+// space, between the modelview and the projection transforms.
+func (ctx *Context) polygon(vs []inputVertex, provoking int) {
+    n := len(vs)
+    modelView := *ctx.topMatrix(MODELVIEW)
+    projection := *ctx.topMatrix(PROJECTION)
+    eyeVerts := make([]Vec4, n)
+    clipVerts := make([]vertex, n)
 
-    for j := 0; j < 4; j++ {
-        transformed := transformVertex(quad.v[j], MatrixModelView)
-        transformedVerts[j] = transformed
-        sx[j], sy[j] = viewportTransform(perspectiveDivide(transformed))
+    for j := range vs {
+        eyeVerts[j] = transformVertex(vs[j].pos, modelView)
+        clipVerts[j].clip = transformVertex(eyeVerts[j], projection)
     }
 
-    v0 := transformedVerts[0] // Per-face lighting
-    v1 := transformedVerts[1] // Face normal in view space
-    v2 := transformedVerts[2]
+    front := ctx.frontFacing(clipVerts)
+    if ctx.cullFaceEnabled && (ctx.cullFace == FRONT_AND_BACK || front == (ctx.cullFace == FRONT)) {
+        return
+    }
 
-    edge1 := Vec3{v1.x - v0.x, v1.y - v0.y, v1.z - v0.z}
-    edge2 := Vec3{v2.x - v0.x, v2.y - v0.y, v2.z - v0.z}
-    normal := normalize(cross(edge1, edge2))
-    
-    var totalR, totalG, totalB float32
-    base := Submit.c
-    
-    enabledLights := false
-    
-    for _, light := range Lights {
-        if !light.enabled {
-            continue
-        }
-        enabledLights = true
-        
-        var L Vec3
-
-        switch(light.Type) {
-        case LIGHT_DIRECTIONAL:
-            L = normalize(light.Dir)
-        case LIGHT_POINT:
-            // Light vector from face center to light
-            center := Vec3{
-                (v0.x + v1.x + v2.x + transformedVerts[3].x) * 0.25,
-                (v0.y + v1.y + v2.y + transformedVerts[3].y) * 0.25,
-                (v0.z + v1.z + v2.z + transformedVerts[3].z) * 0.25,
-            }
-            L = normalize(Vec3{
-                light.Pos.x - center.x,
-                light.Pos.y - center.y,
-                light.Pos.z - center.z,
-            })
-        default:
-            panic(1)
+    normals := normalMatrix(modelView)
+    var faceNormal Vec3 // for vertices given without a normal
+    for _, v := range vs {
+        if !v.hasNormal {
+            faceNormal = normalize(transformNormal(normals, newellNormal(vs)))
+            break
         }
-        
-        diffuse := dot(normal, L)
-        if diffuse < 0 {
-            diffuse = 0
+    }
+    normal := func(j int) Vec3 {
+        if !vs[j].hasNormal {
+            return faceNormal
         }
+        return ctx.eyeNormal(normals, vs[j].normal)
+    }
+    for j := range clipVerts {
+        clipVerts[j].texCoords = ctx.transformTexCoords(vs[j], eyeVerts[j], normal(j))
+        clipVerts[j].fog = ctx.vertexFog(vs[j], eyeVerts[j])
+    }
 
-        totalR += base.r * light.Color.r * diffuse // Add contribution from this light
-        totalG += base.g * light.Color.g * diffuse
-        totalB += base.b * light.Color.b * diffuse
+    mode := ctx.polygonModeFront
+    if !front {
+        mode = ctx.polygonModeBack
     }
-    
-    var color SRColor
-    if enabledLights {
-        if totalR > 1 { totalR = 1 } // Clamp to [0,1]
-        if totalG > 1 { totalG = 1 }
-        if totalB > 1 { totalB = 1 }
-        color = SRColor{r: totalR, g: totalG, b: totalB}
+
+    back := !front && ctx.lighting.twoSide // lit with the back material and a flipped normal
+    perPixel := ctx.shadeModel == PHONG && mode == FILL
+    if perPixel { // lit by shade, from the interpolated position and normal
+        for j := range clipVerts {
+            clipVerts[j].color = vs[j].color
+            clipVerts[j].eye = Vec3{eyeVerts[j].x, eyeVerts[j].y, eyeVerts[j].z}
+            clipVerts[j].normal = normal(j)
+        }
+    } else if ctx.shadeModel == FLAT { // only the provoking vertex is lit
+        color, specular := ctx.lighting.lightVertex(eyeVerts[provoking], normal(provoking), vs[provoking].color, back)
+        for j := range clipVerts {
+            clipVerts[j].color, clipVerts[j].specular = color, specular
+        }
     } else {
-        color = base
+        for j := range clipVerts {
+            clipVerts[j].color, clipVerts[j].specular = ctx.lighting.lightVertex(eyeVerts[j], normal(j), vs[j].color, back)
+        }
     }
-    
-    var distance float32 = 0
-    for j := 0; j < 4; j++ {
-        dx := transformedVerts[j].x
-        dy := transformedVerts[j].y
-        dz := transformedVerts[j].z
-        distance += dx*dx + dy*dy + dz*dz
-    }
-    distance /= 4
-
-    switch polygonModeFront {
-    case LINE:
-        v0 := IVec2{sx[0], sy[0]}
-        v1 := IVec2{sx[1], sy[1]}
-        v2 := IVec2{sx[2], sy[2]}
-        v3 := IVec2{sx[3], sy[3]}
-        drawLine(v0, v1, distance)
-        drawLine(v1, v2, distance)
-        drawLine(v2, v3, distance)
-        drawLine(v3, v0, distance)
+    flat := clipVerts[provoking]
+
+    switch mode {
+    case LINE: // only the original edges, not the ones clipping adds
+        for k := 0; k < n; k++ {
+            ctx.emitLine(clipVerts[k], clipVerts[(k+1)%n], flat)
+        }
     case POINT:
-        for k := 0; k < 4; k++ {
-            if  (sx[k] < framebuffer.h) && (sx[k] > 0) && (sy[k] < framebuffer.v) && (sy[k] > 0) {
-                if zBuffer[sx[k]+sy[k]*framebuffer.h] > distance {
-                    framebuffer.d[sx[k]+sy[k]*framebuffer.h] = SubmitC
-                    zBuffer[sx[k]+sy[k]*framebuffer.h] = distance
-                }
-            }
+        for k := 0; k < n; k++ {
+            ctx.emitPoint(clipVerts[k], flat)
         }
     case FILL:
-        v := [4]IVec2{
-            {sx[0], sy[0]},
-            {sx[1], sy[1]},
-            {sx[2], sy[2]},
-            {sx[3], sy[3]},
+        poly := clipPolygon(clipVerts)
+        if len(poly) < 3 {
+            return
+        }
+        win := make([]screenVertex, len(poly))
+        for k := range poly {
+            win[k] = ctx.window(poly[k])
+        }
+        for k := 1; k < len(win)-1; k++ { // fan around v0
+            ctx.emit(primitive{kind: primTriangle, v: [3]screenVertex{win[0], win[k], win[k+1]}, phong: perPixel, back: back}, flat)
         }
-        fillTriangle(v[0], v[1], v[2], distance, color) // v0-v1-v2
-        fillTriangle(v[0], v[2], v[3], distance, color) // v0-v2-v3
     }
+}
+
+// frontFacing reports whether a polygon winds in window coordinates the
+// way FrontFace says front faces do. It is decided in clip space, before
+// clipping, from the (x, y, w) determinants of a fan over the polygon:
+// their sum has the sign of the visible part's area even when some
+// vertices are behind the eye. Clip y grows upwards, like OpenGL's window
+// y, so CCW polygons have a positive determinant.
+func (ctx *Context) frontFacing(vs []vertex) bool {
+    var det float32
+    a := vs[0].clip
+    for k := 1; k < len(vs)-1; k++ {
+        b, c := vs[k].clip, vs[k+1].clip
+        det += a.x*(b.y*c.w-c.y*b.w) - a.y*(b.x*c.w-c.x*b.w) + a.w*(b.x*c.y-c.x*b.y)
+    }
+    if ctx.frontFace == CW {
+        return det <= 0
+    }
+    return det >= 0
+}
+
+func (ctx *Context) line(a, b inputVertex) {
+    ea, ca := ctx.transform(a.pos)
+    eb, cb := ctx.transform(b.pos)
+    va := vertex{clip: ca, texCoords: ctx.unfacedTexCoords(a, ea), fog: ctx.vertexFog(a, ea)}
+    vb := vertex{clip: cb, texCoords: ctx.unfacedTexCoords(b, eb), fog: ctx.vertexFog(b, eb)}
+    va.color, va.specular = ctx.lightUnfaced(a, ea)
+    vb.color, vb.specular = ctx.lightUnfaced(b, eb)
+    ctx.emitLine(va, vb, vb)
+}
+
+func (ctx *Context) point(a inputVertex) {
+    ea, ca := ctx.transform(a.pos)
+    va := vertex{clip: ca, texCoords: ctx.unfacedTexCoords(a, ea), fog: ctx.vertexFog(a, ea)}
+    va.color, va.specular = ctx.lightUnfaced(a, ea)
+    ctx.emitPoint(va, va)
+}
+
+// lightUnfaced lights a line or point vertex. Those have no face normal
+// to fall back on, so without a normal of their own they keep their color.
+func (ctx *Context) lightUnfaced(v inputVertex, eye Vec4) (SRColor, SRColor) {
+    if !v.hasNormal {
+        return v.color, SRColor{}
+    }
+    return ctx.lighting.lightVertex(eye, ctx.eyeNormal(normalMatrix(*ctx.topMatrix(MODELVIEW)), v.normal), v.color, false)
+}
+
+// unfacedTexCoords returns the texture coordinates of a line or point
+// vertex, generated from its own normal.
+func (ctx *Context) unfacedTexCoords(v inputVertex, eye Vec4) [maxTextureUnits]Vec4 {
+    return ctx.transformTexCoords(v, eye, ctx.eyeNormal(normalMatrix(*ctx.topMatrix(MODELVIEW)), v.normal))
+}
+
+// eyeNormal carries a normal given with Normal3f to eye space, rescaling
+// it to unit length when NORMALIZE is enabled.
+func (ctx *Context) eyeNormal(normals [9]float32, n Vec3) Vec3 {
+    n = transformNormal(normals, n)
+    if ctx.normalize {
+        n = normalize(n)
+    }
+    return n
+}
+
+// newellNormal returns the unnormalized normal of a polygon by Newell's
+// method, which unlike a single cross product survives repeated vertices.
+func newellNormal(vs []inputVertex) Vec3 {
+    var n Vec3
+    for i := range vs {
+        a, b := vs[i].pos, vs[(i+1)%len(vs)].pos
+        n.x += (a.y - b.y) * (a.z + b.z)
+        n.y += (a.z - b.z) * (a.x + b.x)
+        n.z += (a.x - b.x) * (a.y + b.y)
+    }
+    return n
+}
+
+// emitLine clips and queues a line, flat is its color under FLAT shading.
+func (ctx *Context) emitLine(a, b vertex, flat vertex) {
+    a, b, visible := clipLine(a, b)
+    if !visible {
+        return
+    }
+    ctx.emit(primitive{kind: primLine, v: [3]screenVertex{ctx.window(a), ctx.window(b)}}, flat)
+}
+
+func (ctx *Context) emitPoint(a vertex, flat vertex) {
+    if !insideClipVolume(a) {
+        return
+    }
+    ctx.emit(primitive{kind: primPoint, v: [3]screenVertex{ctx.window(a)}}, flat)
+}
 
-    lastVertex = nil
-    SubmitI = 0
+// window carries a clipped vertex to window coordinates.
+func (ctx *Context) window(v vertex) screenVertex {
+    w := ctx.viewportTransform(perspectiveDivide(v.clip))
+    w.invW = 1 / v.clip.w
+    w.color = v.color
+    w.specular = v.specular
+    w.eye, w.normal = v.eye, v.normal
+    w.texCoords = v.texCoords
+    w.fog = v.fog
+    return w
 }
 
-func Translatef(x, y, z float32) {
+func (ctx *Context) Translatef(x, y, z float32) {
     t := [16]float32{
         1, 0, 0, 0,
         0, 1, 0, 0,
         0, 0, 1, 0,
         x, y, z, 1,
     }
-    MatrixModelView = multMatrix(MatrixModelView, t)
+    ctx.MultMatrixf(t)
 }
 
-func Rotatef(angle, x, y, z float32){
+func (ctx *Context) Rotatef(angle, x, y, z float32){
     angle *= (PI / 180.0) // degrees to radians
     length := float32(math.Sqrt(float64(x*x + y*y + z*z))) // normalize axis
     x /= length
@@ -286,21 +729,111 @@ func Rotatef(angle, x, y, z float32){
         x*z*ic+y*s,   y*z*ic-x*s, c + z*z*ic, 0,
         0,            0,          0,          1,
     }
-    MatrixModelView = multMatrix(MatrixModelView, r)
+    ctx.MultMatrixf(r)
 }
 
-func Color3f(r, g, b float32) {
-    SubmitC = SRColor{r, g, b}
+func (ctx *Context) Scalef(x, y, z float32) {
+    s := [16]float32{
+        x, 0, 0, 0,
+        0, y, 0, 0,
+        0, 0, z, 0,
+        0, 0, 0, 1,
+    }
+    ctx.MultMatrixf(s)
+}
+
+// Color3f sets the current color, opaque, which each following Vertex3f
+// takes. Lighting ignores it unless COLOR_MATERIAL is enabled.
+func (ctx *Context) Color3f(r, g, b float32) {
+    ctx.Color4f(r, g, b, 1)
+}
+
+// Color4f sets the current color with alpha a, the opacity that blending
+// and the alpha test use.
+func (ctx *Context) Color4f(r, g, b, a float32) {
+    ctx.submitC = SRColor{r, g, b, a}
+    ctx.trackColor()
+}
+
+// Normal3f sets the current normal, which each following Vertex3f takes.
+// Until it is first called, polygons are lit with their face normal.
+func (ctx *Context) Normal3f(x, y, z float32) {
+    ctx.normal = Vec3{x, y, z}
+    ctx.hasNormal = true
 }
 
-func Begin() { }
-func End() { }
+// ShadeModel selects FLAT shading, where a primitive takes the color of
+// its provoking vertex, SMOOTH shading, where vertex colors are
+// interpolated across it, or PHONG shading, where filled polygons
+// interpolate the eye-space position and normal instead and are lit at
+// every pixel. Lines and points are SMOOTH shaded under PHONG.
+func (ctx *Context) ShadeModel(mode int) {
+    switch mode {
+    case FLAT, SMOOTH, PHONG: ctx.shadeModel = mode
+    default:                  ctx.setError(INVALID_ENUM)
+    }
+}
+
+// inputVertex is a vertex as given to Vertex3f, with the current
+// attributes at that call.
+type inputVertex struct {
+    pos       Vec4
+    color     SRColor
+    normal    Vec3
+    hasNormal bool // false until Normal3f is first called
+    texCoords [maxTextureUnits]Vec4 // TexCoord2f and MultiTexCoord2f
+    fogCoord  float32
+}
+
+// Begin starts a sequence of vertices that Vertex3f assembles into
+// primitives of the given mode (POINTS, LINES, TRIANGLES, QUADS, ...).
+// Begin inside Begin/End records INVALID_OPERATION.
+func (ctx *Context) Begin(mode int) {
+    switch mode {
+    case POINTS, LINES, LINE_STRIP, LINE_LOOP, TRIANGLES, TRIANGLE_STRIP, TRIANGLE_FAN, QUADS, QUAD_STRIP, POLYGON:
+    default:
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    if ctx.inBegin {
+        ctx.setError(INVALID_OPERATION)
+        return
+    }
+    ctx.inBegin = true
+    ctx.mode = mode
+    ctx.stripOdd = false
+    ctx.verts = ctx.verts[:0]
+}
+
+// End finishes the vertices started by Begin. A POLYGON is drawn here and
+// a LINE_LOOP is closed; incomplete primitives are discarded. End
+// without Begin records INVALID_OPERATION.
+func (ctx *Context) End() {
+    if !ctx.inBegin {
+        ctx.setError(INVALID_OPERATION)
+        return
+    }
+    switch ctx.mode {
+    case LINE_LOOP:
+        if len(ctx.verts) == 2 {
+            ctx.line(ctx.verts[1], ctx.verts[0])
+        }
+    case POLYGON:
+        if len(ctx.verts) >= 3 {
+            ctx.polygon(ctx.verts, 0)
+        }
+    }
+    ctx.inBegin = false
+    ctx.verts = ctx.verts[:0]
+    ctx.flush()
+}
 
-func ReadPixels() (image [][3]float32) {
-    mx, my  := XY()
+func (ctx *Context) ReadPixels() (image [][3]float32) {
+    ctx.flush()
+    mx, my  := ctx.XY()
     for i := 0; i < my; i++ {
         for j := 0; j < mx; j++ {
-            fbcolor := framebuffer.d[j+i*mx]
+            fbcolor := ctx.framebuffer.d[j+i*mx]
             image = append(image, [3]float32{
                 fbcolor.r,
                 fbcolor.g,
@@ -311,12 +844,30 @@ func ReadPixels() (image [][3]float32) {
     return image
 }
 
-func ClearColor(r, g, b float32) {
-    mx, my  := XY()
-    for i := 0; i < my; i++ {
-        for j := 0; j < mx; j++ {
-            framebuffer.d[j+i*mx] = SRColor{r,g,b}
-            zBuffer[j+i*mx] = 999999999.0
+// ReadPixelsRGBA is ReadPixels with the alpha of each pixel.
+func (ctx *Context) ReadPixelsRGBA() (image [][4]float32) {
+    ctx.flush()
+    for _, c := range ctx.framebuffer.d {
+        image = append(image, [4]float32{c.r, c.g, c.b, c.a})
+    }
+    return image
+}
+
+// ClearColor fills the color buffer with an opaque color. The depth
+// buffer is cleared separately by ClearDepth.
+func (ctx *Context) ClearColor(r, g, b float32) {
+    ctx.ClearColor4f(r, g, b, 1)
+}
+
+// ClearColor4f fills the color buffer with a color and alpha, within the
+// scissor box when SCISSOR_TEST is enabled.
+func (ctx *Context) ClearColor4f(r, g, b, a float32) {
+    ctx.flush()
+    mx, _ := ctx.XY()
+    box   := ctx.clearRect()
+    for i := box.y0; i < box.y1; i++ {
+        for j := box.x0; j < box.x1; j++ {
+            ctx.framebuffer.d[j+i*mx] = SRColor{r,g,b,a}
         }
     }
 }
@@ -330,10 +881,12 @@ func transformVertex(v Vec4, m [16]float32) Vec4 {
     }
 }
 
-func viewportTransform(v Vec3) (x, y int) {
-    x = int((v.x + 1.0) * 0.5 * float32(framebuffer.h))
-    y = int((1.0 - (v.y + 1.0) * 0.5) * float32(framebuffer.v)) // flip Y axis for screen
-    return
+func (ctx *Context) viewportTransform(v Vec3) screenVertex {
+    return screenVertex{
+        x: (v.x + 1.0) * 0.5 * float32(ctx.framebuffer.h),
+        y: (1.0 - (v.y + 1.0) * 0.5) * float32(ctx.framebuffer.v), // flip Y axis for screen
+        z: ctx.depthNear + (v.z + 1.0) * 0.5 * (ctx.depthFar - ctx.depthNear),
+    }
 }
 
 func perspectiveDivide(v Vec4) Vec3 {
@@ -346,6 +899,9 @@ func perspectiveDivide(v Vec4) Vec3 {
 
 func normalize(v Vec3) Vec3 {
     len := float32(math.Sqrt(float64(v.x*v.x + v.y*v.y + v.z*v.z)))
+    if len == 0 { // degenerate, leave it as the zero vector rather than NaN
+        return v
+    }
     return Vec3{v.x / len, v.y / len, v.z / len}
 }
 
@@ -381,12 +937,13 @@ func LookAt(a1, a2, a3, b1, b2, b3 float32) [16]float32 {
 	}
 }
 
+// Frustum returns a column-major perspective projection, like glFrustum.
 func Frustum(left, right, bottom, top, near, far float32) [16]float32 {
 	return [16]float32{
-		(2.0*near)/(right-left),                    0,(right+left)/(right-left),                                0,
-                              0,(2*near)/(top-bottom),(top+bottom)/(top-bottom),                                0,
-                              0,                    0,   -(far+near)/(far-near), -2.0 * far * near / (far - near),
-                              0,                    0,                       -1,                                0,
+		  (2.0*near)/(right-left),                         0,                               0,  0,
+		                        0,     (2*near)/(top-bottom),                               0,  0,
+		(right+left)/(right-left), (top+bottom)/(top-bottom),         -(far+near)/(far-near), -1,
+		                        0,                         0, -2.0 * far * near / (far - near),  0,
 	}
 }
 
@@ -404,19 +961,63 @@ func multMatrix(a, b [16]float32) [16]float32 {
 	return r
 }
 
-func SetCamera(projection, view [16]float32) {
-    MatrixModelView = multMatrix(projection, view)
+// SetCamera loads projection and view into the tops of the PROJECTION and
+// MODELVIEW stacks.
+func (ctx *Context) SetCamera(projection, view [16]float32) {
+    *ctx.topMatrix(PROJECTION) = projection
+    *ctx.topMatrix(MODELVIEW)  = view
 }
 
-func drawLine(a, b IVec2, distance float32) {
+// emit hands a primitive to the rasterizer: straight away on the serial
+// path, or queued for the next flush when tiled rendering is enabled.
+func (ctx *Context) emit(p primitive, flat vertex) {
+    p.color, p.specular = flat.color, flat.specular
+    p.smooth = ctx.shadeModel != FLAT
+    p.state = ctx.fragmentState
+    p.tex = ctx.textureStages()
+    if p.phong {
+        lighting := ctx.lighting
+        p.lighting = &lighting
+    }
+    if ctx.workers > 1 {
+        ctx.prims = append(ctx.prims, p)
+        return
+    }
+    ctx.rasterize(&p, ctx.bounds())
+}
+
+// rasterize draws p, touching only the pixels inside r.
+func (ctx *Context) rasterize(p *primitive, r rect) {
+    if p.state.scissorTest {
+        r = r.intersect(ctx.scissorRect(p.state.scissor))
+    }
+    switch p.kind {
+    case primPoint:
+        ctx.drawPoint(p, r)
+    case primLine:
+        ctx.drawLine(p, r)
+    case primTriangle:
+        ctx.fillTriangle(p, r)
+    }
+}
+
+func (ctx *Context) drawPoint(p *primitive, r rect) {
+    x, y := int(math.Floor(float64(p.v[0].x))), int(math.Floor(float64(p.v[0].y)))
+    if r.contains(x, y) {
+        ctx.shade(p, x, y, p.v[0].z, [3]float32{1, 0, 0}, [3]float32{}, [3]float32{})
+    }
+}
+
+func (ctx *Context) drawLine(p *primitive, r rect) {
     abs := func (f int) int {
         if f < 0 {
             return -f
         }
         return f
     }
-    x0, y0 := a.x, a.y
-    x1, y1 := b.x, b.y
+    a, b := p.v[0], p.v[1]
+    x0, y0 := int(math.Floor(float64(a.x))), int(math.Floor(float64(a.y)))
+    x1, y1 := int(math.Floor(float64(b.x))), int(math.Floor(float64(b.y)))
     dx :=  abs(x1 - x0)
     dy := -abs(y1 - y0)
     sx := 1
@@ -427,17 +1028,25 @@ func drawLine(a, b IVec2, distance float32) {
     if y0 >= y1 {
         sy = -1
     }
+    steps := float32(max(dx, -dy)) // attributes are interpolated along the major axis
+    var perPixel [3]float32 // change of the weights from one pixel to the next
+    if steps > 0 {
+        perPixel = [3]float32{-1 / steps, 1 / steps, 0}
+    }
+    step := 0
     err := dx + dy
     for {
-        if  (x0 < framebuffer.h) && (x0 > 0) && (y0 < framebuffer.v) && (y0 > 0) {
-            if zBuffer[x0+y0*framebuffer.h] > distance {
-                framebuffer.d[x0+y0*framebuffer.h] = SubmitC
-                zBuffer[x0+y0*framebuffer.h] = distance
+        if r.contains(x0, y0) {
+            t := float32(0)
+            if steps > 0 {
+                t = float32(step) / steps
             }
+            ctx.shade(p, x0, y0, a.z+(b.z-a.z)*t, [3]float32{1 - t, t, 0}, perPixel, [3]float32{})
         }
         if x0 == x1 && y0 == y1 {
             break
         }
+        step++
         e2 := 2 * err
         if e2 >= dy {
             err += dy
@@ -450,51 +1059,133 @@ func drawLine(a, b IVec2, distance float32) {
     }
 }
 
-func fillTriangle(v0, v1, v2 IVec2, distance float32, color SRColor) {
-    edgeInterpolate := func(y0, y1, x0, x1 int) []int {
-        var result []int
-        dy := y1 - y0
-        if dy == 0 {
-            return []int{x0}
-        }
-        dx := x1 - x0
-        for i := 0; i <= dy; i++ {
-            x := x0 + dx*i/dy
-            result = append(result, x)
+// fillTriangle samples every pixel center of the triangle's bounding box
+// inside r with edge functions, so each pixel gets the same coverage and
+// depth however the screen is split into tiles. Pixels exactly on an
+// edge belong to only one of the two triangles sharing it.
+func (ctx *Context) fillTriangle(p *primitive, r rect) {
+    v0, v1, v2 := p.v[0], p.v[1], p.v[2]
+    edge := func(a, b screenVertex, x, y float32) float32 {
+        if a.y > b.y || (a.y == b.y && a.x > b.x) { // same rounding both ways round
+            return -((a.x-b.x)*(y-b.y) - (a.y-b.y)*(x-b.x))
         }
-        return result
-    }
-    if v1.y < v0.y {     // Sort vertices by y-coordinate ascending (v0.y <= v1.y <= v2.y)
-        v0, v1 = v1, v0
+        return (b.x-a.x)*(y-a.y) - (b.y-a.y)*(x-a.x)
     }
-    if v2.y < v0.y {
-        v0, v2 = v2, v0
+    area := edge(v0, v1, v2.x, v2.y)
+    if area == 0 {
+        return
     }
-    if v2.y < v1.y {
+    swapped := area < 0
+    if swapped { // make the winding positive so all inside weights are too
         v1, v2 = v2, v1
+        area = -area
+    }
+    owns := func(a, b screenVertex) bool { // pixels on the edge a-b belong to this triangle
+        return b.y > a.y || (b.y == a.y && b.x < a.x)
+    }
+    own0, own1, own2 := owns(v1, v2), owns(v2, v0), owns(v0, v1)
+    var dx, dy [3]float32 // change of the weights, in p.v order, from one pixel to the next
+    for i := range dx {
+        a, c := p.v[(i+1)%3], p.v[(i+2)%3]
+        dx[i], dy[i] = a.y-c.y, c.x-a.x
+        if swapped {
+            dx[i], dy[i] = -dx[i], -dy[i]
+        }
     }
-    x01 := edgeInterpolate(v0.y, v1.y, v0.x, v1.x)
-    x12 := edgeInterpolate(v1.y, v2.y, v1.x, v2.x)
-    x02 := edgeInterpolate(v0.y, v2.y, v0.x, v2.x)
-    x012 := append(x01[:len(x01)-1], x12...)
-    yStart := v0.y
-    yEnd := v2.y
-    for y := yStart; y <= yEnd; y++ {
-        i := y - yStart
-        var xa, xb int
-        if i < len(x02) && i < len(x012) {
-            xa, xb = x02[i], x012[i]
-            if xa > xb {
-                xa, xb = xb, xa
+
+    b := p.bounds().intersect(r)
+    for y := b.y0; y < b.y1; y++ {
+        py := float32(y) + 0.5
+        for x := b.x0; x < b.x1; x++ {
+            px := float32(x) + 0.5
+            w0 := edge(v1, v2, px, py)
+            w1 := edge(v2, v0, px, py)
+            w2 := edge(v0, v1, px, py)
+            if w0 < 0 || w1 < 0 || w2 < 0 ||
+                (w0 == 0 && !own0) || (w1 == 0 && !own1) || (w2 == 0 && !own2) {
+                continue
             }
-            for x := xa; x <= xb; x++ {
-                if  (x < framebuffer.h) && (x > 0) && (y < framebuffer.v) && (y > 0) {
-                    if zBuffer[x+y*framebuffer.h] > distance {
-                        framebuffer.d[x+y*framebuffer.h] = color
-                        zBuffer[x+y*framebuffer.h] = distance
-                    }
-                }
+            z := (w0*v0.z + w1*v1.z + w2*v2.z) / area
+            if swapped {
+                w1, w2 = w2, w1
             }
+            ctx.shade(p, x, y, z, [3]float32{w0, w1, w2}, dx, dy)
         }
     }
 }
+
+// shade interpolates the attributes of p at a fragment whose position is
+// given by weights of p's vertices in window space, and runs the fragment
+// stage on it. The weights are corrected for perspective by interpolating
+// a/w and 1/w. dx and dy are how much the weights change one pixel right
+// and down, from which texturing finds how large the pixel is on the
+// texture.
+func (ctx *Context) shade(p *primitive, x, y int, z float32, weights, dx, dy [3]float32) {
+    persp := p.perspective(weights)
+    color, specular := p.color, p.specular
+    if p.smooth {
+        color, specular = SRColor{}, SRColor{}
+        for i, w := range persp {
+            color = color.add(p.v[i].color.scale(w))
+            specular = specular.add(p.v[i].specular.scale(w))
+        }
+    }
+    if p.phong {
+        var eye, normal Vec3
+        for i, w := range persp {
+            eye = eye.add(p.v[i].eye.scale(w))
+            normal = normal.add(p.v[i].normal.scale(w))
+        }
+        color, specular = p.lighting.lightVertex(Vec4{eye.x, eye.y, eye.z, 1}, normalize(normal), color, p.back)
+    }
+    for i := range weights { // weights one pixel right and down
+        dx[i] += weights[i]
+        dy[i] += weights[i]
+    }
+    for u := range p.tex {
+        st := &p.tex[u]
+        if st.texture == nil {
+            continue
+        }
+        s, t := p.texCoordAt(u, persp)
+        sx, tx := p.texCoordAt(u, p.perspective(dx))
+        sy, ty := p.texCoordAt(u, p.perspective(dy))
+        color = st.apply(color, st.texture.sample(s, t, sx-s, tx-t, sy-s, ty-t))
+    }
+    color = color.add(specular).clamp()
+    if p.state.fog.enabled {
+        var fog float32
+        for i, w := range persp {
+            fog += p.v[i].fog * w
+        }
+        color = p.state.fog.apply(color, fog)
+    }
+    ctx.fragment(p, x, y, z, color)
+}
+
+// perspective turns window-space weights of p's vertices into weights of
+// their attributes, which sum to 1.
+func (p *primitive) perspective(weights [3]float32) [3]float32 {
+    var sum float32
+    for i := range weights {
+        weights[i] *= p.v[i].invW
+        sum += weights[i]
+    }
+    if sum == 0 {
+        return [3]float32{1, 0, 0}
+    }
+    for i := range weights {
+        weights[i] /= sum
+    }
+    return weights
+}
+
+// texCoordAt returns the texture coordinates s/q and t/q of unit at
+// attribute weights persp.
+func (p *primitive) texCoordAt(unit int, persp [3]float32) (float32, float32) {
+    var tc Vec4
+    for i, w := range persp {
+        tc = tc.add(p.v[i].texCoords[unit].scale(w))
+    }
+    return tc.x / tc.w, tc.y / tc.w
+}
@@ -0,0 +1,106 @@
+package sr
+
+import "math"
+
+// texGen generates one texture coordinate, S, T, R or Q, when enabled
+// with TEXTURE_GEN_S and the like.
+type texGen struct {
+    enabled     bool
+    mode        int  // TEXTURE_GEN_MODE
+    objectPlane Vec4 // OBJECT_PLANE
+    eyePlane    Vec4 // EYE_PLANE, in eye space
+}
+
+// defaultTexGens are the texGens of a new context: EYE_LINEAR, with planes
+// that copy x to s and y to t.
+var defaultTexGens = [4]texGen{
+    {mode: EYE_LINEAR, objectPlane: Vec4{1, 0, 0, 0}, eyePlane: Vec4{1, 0, 0, 0}},
+    {mode: EYE_LINEAR, objectPlane: Vec4{0, 1, 0, 0}, eyePlane: Vec4{0, 1, 0, 0}},
+    {mode: EYE_LINEAR},
+    {mode: EYE_LINEAR},
+}
+
+// TexGeni sets the TEXTURE_GEN_MODE of coord, S, T, R or Q, of the active
+// unit:
+// OBJECT_LINEAR, the distance of the object-space vertex to OBJECT_PLANE;
+// EYE_LINEAR, the distance of the eye-space vertex to EYE_PLANE;
+// SPHERE_MAP, for S and T only, the sphere map position of the eye
+// vector reflected about the normal; or REFLECTION_MAP, for S, T and R,
+// that reflected vector itself.
+func (ctx *Context) TexGeni(coord, pname, param int) {
+    if coord < S || coord > Q || pname != TEXTURE_GEN_MODE {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    switch {
+    case param == OBJECT_LINEAR || param == EYE_LINEAR:
+    case param == SPHERE_MAP && coord <= T:
+    case param == REFLECTION_MAP && coord <= R:
+    default:
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    ctx.unit().texGens[coord-S].mode = param
+}
+
+// TexGenfv sets the OBJECT_PLANE or EYE_PLANE (a, b, c, d) of coord. Like
+// light positions, eye planes are carried to eye space by the modelview
+// matrix at the time of the call. A plane without d records INVALID_VALUE.
+func (ctx *Context) TexGenfv(coord, pname int, value []float32) {
+    if coord < S || coord > Q {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    if len(value) < 4 {
+        ctx.setError(INVALID_VALUE)
+        return
+    }
+    plane := Vec4{value[0], value[1], value[2], value[3]}
+    switch pname {
+    case OBJECT_PLANE:
+        ctx.unit().texGens[coord-S].objectPlane = plane
+    case EYE_PLANE: // the plane times the inverse modelview
+        inv := invertMatrix(*ctx.topMatrix(MODELVIEW))
+        col := func(i int) Vec4 { return Vec4{inv[i*4], inv[i*4+1], inv[i*4+2], inv[i*4+3]} }
+        ctx.unit().texGens[coord-S].eyePlane = Vec4{dot4(plane, col(0)), dot4(plane, col(1)), dot4(plane, col(2)), dot4(plane, col(3))}
+    default:
+        ctx.setError(INVALID_ENUM)
+    }
+}
+
+// generateTexCoord returns the texture coordinates texCoord of a vertex at
+// object-space pos, with the ones unit generates replaced. eye and normal
+// are the vertex in eye space.
+func (unit *textureUnit) generateTexCoord(pos, texCoord, eye Vec4, normal Vec3) Vec4 {
+    tc := [4]float32{texCoord.x, texCoord.y, texCoord.z, texCoord.w}
+    var r [3]float32 // the eye vector reflected about the normal, for SPHERE_MAP and REFLECTION_MAP
+    for _, g := range unit.texGens {
+        if g.enabled && (g.mode == SPHERE_MAP || g.mode == REFLECTION_MAP) {
+            u := normalize(Vec3{eye.x, eye.y, eye.z})
+            n := normalize(normal)
+            ref := u.add(n.scale(-2 * dot(n, u)))
+            r = [3]float32{ref.x, ref.y, ref.z}
+            break
+        }
+    }
+    for i, g := range unit.texGens {
+        if !g.enabled {
+            continue
+        }
+        switch g.mode {
+        case OBJECT_LINEAR:  tc[i] = dot4(g.objectPlane, pos)
+        case EYE_LINEAR:     tc[i] = dot4(g.eyePlane, eye)
+        case REFLECTION_MAP: tc[i] = r[i]
+        case SPHERE_MAP:
+            tc[i] = 0.5
+            if m := 2 * float32(math.Sqrt(float64(r[0]*r[0] + r[1]*r[1] + (r[2]+1)*(r[2]+1)))); m > 0 { // 0 only for r = (0, 0, -1)
+                tc[i] += r[i] / m
+            }
+        }
+    }
+    return Vec4{tc[0], tc[1], tc[2], tc[3]}
+}
+
+func dot4(a, b Vec4) float32 {
+    return a.x*b.x + a.y*b.y + a.z*b.z + a.w*b.w
+}
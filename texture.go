@@ -0,0 +1,514 @@
+package sr
+
+import (
+    "image"
+    "image/color"
+    "math"
+)
+
+// texture is a texture object: its images and sampling parameters.
+type texture struct {
+    levels         []texImage // mipmap levels, 0 is the base image
+    format         int        // RGB or RGBA, of the base image
+    minFilter      int        // NEAREST, LINEAR or one of the MIPMAP filters
+    magFilter      int        // NEAREST or LINEAR
+    wrapS          int        // REPEAT, CLAMP or MIRRORED_REPEAT
+    wrapT          int
+    maxAnisotropy  float32    // TEXTURE_MAX_ANISOTROPY
+    generateMipmap bool       // GENERATE_MIPMAP, rebuild the levels when the base changes
+}
+
+// maxTextureUnits is the number of texture units, TEXTURE0 to TEXTURE3.
+const maxTextureUnits = 4
+
+// textureUnit is the state of one texture unit. The texture functions,
+// Enable(TEXTURE_2D), TexEnv, TexGen and the TEXTURE matrix stack change
+// the unit ActiveTexture selects.
+type textureUnit struct {
+    texCoord     Vec4      // current texture coordinates
+    boundTexture int       // name bound to TEXTURE_2D
+    texture2D    bool      // TEXTURE_2D
+    envMode      int       // TEXTURE_ENV_MODE
+    envColor     SRColor   // TEXTURE_ENV_COLOR
+    texGens      [4]texGen // S, T, R and Q
+}
+
+var defaultTextureUnit = textureUnit{texCoord: Vec4{0, 0, 0, 1}, envMode: MODULATE, texGens: defaultTexGens}
+
+// ActiveTexture selects the texture unit, TEXTURE0 to TEXTURE3, that
+// texture state calls change.
+func (ctx *Context) ActiveTexture(texture int) {
+    if texture < TEXTURE0 || texture >= TEXTURE0+maxTextureUnits {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    ctx.activeTexture = texture - TEXTURE0
+}
+
+func (ctx *Context) unit() *textureUnit {
+    return &ctx.units[ctx.activeTexture]
+}
+
+// boundTexture returns the texture bound to the active unit.
+func (ctx *Context) boundTexture() *texture {
+    return ctx.textures[ctx.unit().boundTexture]
+}
+
+// texImage is one image of a texture. Row 0 is at t = 0, the bottom.
+type texImage struct {
+    w, h   int
+    texels []SRColor
+}
+
+func newTexture() *texture {
+    return &texture{minFilter: LINEAR, magFilter: LINEAR, wrapS: REPEAT, wrapT: REPEAT, maxAnisotropy: 1}
+}
+
+// complete reports whether t has a base image to sample.
+func (t *texture) complete() bool {
+    return len(t.levels) > 0 && len(t.levels[0].texels) > 0
+}
+
+// GenTextures returns n unused texture names. Names become texture
+// objects when first bound; 0 is the default texture.
+func (ctx *Context) GenTextures(n int) []int {
+    names := make([]int, n)
+    for i := range names {
+        ctx.nextTexture++
+        names[i] = ctx.nextTexture
+    }
+    return names
+}
+
+// DeleteTextures deletes texture objects. A deleted texture that is bound
+// to a unit is replaced there by the default texture.
+func (ctx *Context) DeleteTextures(names []int) {
+    for _, name := range names {
+        if name == 0 {
+            continue
+        }
+        delete(ctx.textures, name)
+        for u := range ctx.units {
+            if ctx.units[u].boundTexture == name {
+                ctx.units[u].boundTexture = 0
+            }
+        }
+    }
+}
+
+// BindTexture makes texture the TEXTURE_2D texture of the active unit,
+// which the texture functions change and primitives are drawn with,
+// creating it if it does not exist yet.
+func (ctx *Context) BindTexture(target, texture int) {
+    if target != TEXTURE_2D {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    if ctx.textures[texture] == nil {
+        ctx.textures[texture] = newTexture()
+    }
+    ctx.unit().boundTexture = texture
+}
+
+// TexImage2D sets a mipmap level of the bound texture to width by height
+// texels, row by row from t = 0, of format RGB, three floats in [0, 1]
+// each, or RGBA, four. RGB texels are opaque.
+func (ctx *Context) TexImage2D(target, level, width, height, format int, pixels []float32) {
+    n := components(format)
+    if target != TEXTURE_2D || n == 0 {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    if level < 0 || width < 0 || height < 0 || len(pixels) < width*height*n {
+        ctx.setError(INVALID_VALUE)
+        return
+    }
+    img := texImage{width, height, make([]SRColor, width*height)}
+    for i := range img.texels {
+        img.texels[i] = colorv(pixels[i*n : i*n+n])
+    }
+    ctx.setLevel(level, format, img)
+}
+
+// components returns the floats per texel of format, 0 for one that is
+// not RGB or RGBA.
+func components(format int) int {
+    switch format {
+    case RGB:  return 3
+    case RGBA: return 4
+    }
+    return 0
+}
+
+// TexImage2DFromImage sets a mipmap level of the bound texture to img, as
+// RGBA. The top row of img ends up at t = 1, so it is the right way up on
+// geometry whose t grows upwards.
+func (ctx *Context) TexImage2DFromImage(target, level int, img image.Image) {
+    if target != TEXTURE_2D {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    if level < 0 {
+        ctx.setError(INVALID_VALUE)
+        return
+    }
+    b := img.Bounds()
+    ti := texImage{b.Dx(), b.Dy(), make([]SRColor, b.Dx()*b.Dy())}
+    for y := 0; y < ti.h; y++ {
+        for x := 0; x < ti.w; x++ {
+            c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Max.Y-1-y)).(color.NRGBA)
+            ti.texels[x+y*ti.w] = SRColor{float32(c.R) / 255, float32(c.G) / 255, float32(c.B) / 255, float32(c.A) / 255}
+        }
+    }
+    ctx.setLevel(level, RGBA, ti)
+}
+
+func (ctx *Context) setLevel(level, format int, img texImage) {
+    t := ctx.boundTexture()
+    for len(t.levels) <= level {
+        t.levels = append(t.levels, texImage{})
+    }
+    t.levels[level] = img
+    if level == 0 {
+        t.format = format
+    }
+    if level == 0 && t.generateMipmap {
+        ctx.generateMipmap(t)
+    }
+}
+
+// TexSubImage2D replaces the width by height RGB or RGBA texels at (x, y)
+// of a mipmap level of the bound texture.
+func (ctx *Context) TexSubImage2D(target, level, x, y, width, height, format int, pixels []float32) {
+    n := components(format)
+    if target != TEXTURE_2D || n == 0 {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    t := ctx.boundTexture()
+    if level < 0 || level >= len(t.levels) {
+        ctx.setError(INVALID_VALUE)
+        return
+    }
+    img := &t.levels[level]
+    if x < 0 || y < 0 || width < 0 || height < 0 || x+width > img.w || y+height > img.h ||
+        len(pixels) < width*height*n {
+        ctx.setError(INVALID_VALUE)
+        return
+    }
+    for j := 0; j < height; j++ {
+        for i := 0; i < width; i++ {
+            k := (i + j*width) * n
+            img.texels[x+i+(y+j)*img.w] = colorv(pixels[k : k+n])
+        }
+    }
+    if level == 0 && t.generateMipmap {
+        ctx.generateMipmap(t)
+    }
+}
+
+// TexParameteri sets a sampling parameter of the bound texture:
+//
+//   - TEXTURE_MAG_FILTER to NEAREST or LINEAR (the default).
+//   - TEXTURE_MIN_FILTER to NEAREST, LINEAR (the default), or one of
+//     NEAREST_MIPMAP_NEAREST, LINEAR_MIPMAP_NEAREST,
+//     NEAREST_MIPMAP_LINEAR and LINEAR_MIPMAP_LINEAR, which pick (or
+//     blend) the mipmap levels closest to the pixel's size on the texture.
+//   - TEXTURE_WRAP_S and TEXTURE_WRAP_T to REPEAT, CLAMP (to the edge
+//     texels) or MIRRORED_REPEAT.
+//   - GENERATE_MIPMAP nonzero to rebuild the mipmap levels from the base
+//     level whenever it changes, and right away.
+func (ctx *Context) TexParameteri(target, pname, param int) {
+    if target != TEXTURE_2D {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    t := ctx.boundTexture()
+    switch pname {
+    case TEXTURE_MAG_FILTER:
+        if param != NEAREST && param != LINEAR {
+            ctx.setError(INVALID_ENUM)
+            return
+        }
+        t.magFilter = param
+    case TEXTURE_MIN_FILTER:
+        switch param {
+        case NEAREST, LINEAR, NEAREST_MIPMAP_NEAREST, LINEAR_MIPMAP_NEAREST, NEAREST_MIPMAP_LINEAR, LINEAR_MIPMAP_LINEAR:
+            t.minFilter = param
+        default:
+            ctx.setError(INVALID_ENUM)
+        }
+    case GENERATE_MIPMAP:
+        t.generateMipmap = param != 0
+        if t.generateMipmap && t.complete() {
+            ctx.generateMipmap(t)
+        }
+    case TEXTURE_WRAP_S, TEXTURE_WRAP_T:
+        if param != REPEAT && param != CLAMP && param != MIRRORED_REPEAT {
+            ctx.setError(INVALID_ENUM)
+            return
+        }
+        if pname == TEXTURE_WRAP_S {
+            t.wrapS = param
+        } else {
+            t.wrapT = param
+        }
+    default:
+        ctx.setError(INVALID_ENUM)
+    }
+}
+
+// TexParameterf sets TEXTURE_MAX_ANISOTROPY of the bound texture, the
+// most samples, at least 1, taken across a pixel that covers a long and
+// thin part of the texture. 1, the default, turns anisotropic filtering
+// off.
+func (ctx *Context) TexParameterf(target, pname int, param float32) {
+    if target != TEXTURE_2D || pname != TEXTURE_MAX_ANISOTROPY {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    if param < 1 {
+        ctx.setError(INVALID_VALUE)
+        return
+    }
+    ctx.boundTexture().maxAnisotropy = param
+}
+
+// TexCoord2f sets the current texture coordinates of TEXTURE0, which each
+// following Vertex3f takes.
+func (ctx *Context) TexCoord2f(s, t float32) {
+    ctx.units[0].texCoord = Vec4{s, t, 0, 1}
+}
+
+// MultiTexCoord2f sets the current texture coordinates of the unit
+// target, TEXTURE0 to TEXTURE3.
+func (ctx *Context) MultiTexCoord2f(target int, s, t float32) {
+    if target < TEXTURE0 || target >= TEXTURE0+maxTextureUnits {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    ctx.units[target-TEXTURE0].texCoord = Vec4{s, t, 0, 1}
+}
+
+// transformTexCoords returns the texture coordinates of v for each unit,
+// generated by the unit's TexGen from the eye-space position and normal
+// where enabled, transformed by the unit's texture matrix.
+func (ctx *Context) transformTexCoords(v inputVertex, eye Vec4, normal Vec3) [maxTextureUnits]Vec4 {
+    var tcs [maxTextureUnits]Vec4
+    for u := range ctx.units {
+        stack := ctx.matrixStacks[2+u]
+        tcs[u] = transformVertex(ctx.units[u].generateTexCoord(v.pos, v.texCoords[u], eye, normal), stack[len(stack)-1])
+    }
+    return tcs
+}
+
+// textureStage is how one unit textures a primitive: the texture, nil
+// when the unit's TEXTURE_2D is disabled or its bound texture has no
+// image, and the texture environment that combines its color with the
+// fragment's.
+type textureStage struct {
+    texture  *texture
+    envMode  int     // TEXTURE_ENV_MODE
+    envColor SRColor // TEXTURE_ENV_COLOR
+}
+
+func (ctx *Context) textureStages() [maxTextureUnits]textureStage {
+    var stages [maxTextureUnits]textureStage
+    for u, unit := range ctx.units {
+        stages[u] = textureStage{envMode: unit.envMode, envColor: unit.envColor}
+        if t := ctx.textures[unit.boundTexture]; unit.texture2D && t.complete() {
+            stages[u].texture = t
+        }
+    }
+    return stages
+}
+
+// TexEnvi sets TEXTURE_ENV_MODE of the active unit, how its texture color
+// Ct and alpha At combine with the fragment color Cf and alpha Af, as
+// OpenGL 1.3 defines it:
+//
+//     MODULATE (the default)  Cf * Ct                  Af * At
+//     REPLACE                 Ct                       At, Af for RGB
+//     DECAL                   Cf * (1 - At) + Ct * At  Af
+//     BLEND                   Cf * (1 - Ct) + Cc * Ct  Af * At
+//     ADD                     Cf + Ct                  Af * At
+//
+// where Cc is TEXTURE_ENV_COLOR and At is 1 for RGB textures. Units
+// apply in order, each to the color the one before produced, starting
+// from the lit color.
+func (ctx *Context) TexEnvi(target, pname, param int) {
+    if target != TEXTURE_ENV || pname != TEXTURE_ENV_MODE {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    switch param {
+    case MODULATE, REPLACE, DECAL, BLEND, ADD: ctx.unit().envMode = param
+    default:                                   ctx.setError(INVALID_ENUM)
+    }
+}
+
+// TexEnvfv sets TEXTURE_ENV_COLOR, the RGB constant color of the BLEND
+// texture environment. Fewer than three values record INVALID_VALUE.
+func (ctx *Context) TexEnvfv(target, pname int, value []float32) {
+    if target != TEXTURE_ENV || pname != TEXTURE_ENV_COLOR {
+        ctx.setError(INVALID_ENUM)
+        return
+    }
+    if len(value) < 3 {
+        ctx.setError(INVALID_VALUE)
+        return
+    }
+    ctx.unit().envColor = colorv(value)
+}
+
+// apply combines the fragment color c with the texture color ct.
+func (st *textureStage) apply(c, ct SRColor) SRColor {
+    switch st.envMode {
+    case REPLACE:
+        if st.texture.format == RGB {
+            ct.a = c.a
+        }
+        return ct
+    case DECAL:
+        return SRColor{
+            c.r*(1-ct.a) + ct.r*ct.a,
+            c.g*(1-ct.a) + ct.g*ct.a,
+            c.b*(1-ct.a) + ct.b*ct.a,
+            c.a,
+        }
+    case BLEND:
+        return SRColor{
+            c.r*(1-ct.r) + st.envColor.r*ct.r,
+            c.g*(1-ct.g) + st.envColor.g*ct.g,
+            c.b*(1-ct.b) + st.envColor.b*ct.b,
+            c.a * ct.a,
+        }
+    case ADD:
+        sum := c.add(ct).clamp()
+        sum.a = c.a * ct.a
+        return sum
+    }
+    return c.mul(ct) // MODULATE
+}
+
+// sample returns the color of t at (s, u), where moving one pixel right
+// or down moves the coordinates by (dsx, dux) or (dsy, duy). Those give
+// the level of detail lambda, the log2 of how many texels a pixel covers:
+// the magnification filter applies up to 0 and the minification one
+// above. With TEXTURE_MAX_ANISOTROPY above 1, a pixel stretched over the
+// texture is sampled several times along its long axis, at the finer
+// level of detail of its short one.
+func (t *texture) sample(s, u, dsx, dux, dsy, duy float32) SRColor {
+    w, h := float32(t.levels[0].w), float32(t.levels[0].h)
+    px := float32(math.Hypot(float64(dsx*w), float64(dux*h)))
+    py := float32(math.Hypot(float64(dsy*w), float64(duy*h)))
+    major, minor := px, py
+    axisS, axisU := dsx, dux
+    if py > px {
+        major, minor = py, px
+        axisS, axisU = dsy, duy
+    }
+    n := float32(1)
+    if t.maxAnisotropy > 1 && minor > 0 {
+        n = min(float32(math.Ceil(float64(major/minor))), t.maxAnisotropy)
+    }
+    lambda := float32(math.Log2(float64(major / n)))
+    if lambda <= 0 {
+        return t.sampleLevel(0, t.magFilter, s, u)
+    }
+    if n == 1 {
+        return t.sampleLOD(lambda, s, u)
+    }
+    var c SRColor
+    for i := float32(0); i < n; i++ { // spread over the footprint's long axis
+        f := (i+0.5)/n - 0.5
+        c = c.add(t.sampleLOD(lambda, s+axisS*f, u+axisU*f))
+    }
+    return c.scale(1 / n)
+}
+
+// sampleLOD samples t minified at level of detail lambda > 0.
+func (t *texture) sampleLOD(lambda, s, u float32) SRColor {
+    last := float32(t.mipLevels() - 1)
+    switch t.minFilter {
+    case NEAREST, LINEAR:
+        return t.sampleLevel(0, t.minFilter, s, u)
+    case NEAREST_MIPMAP_NEAREST, LINEAR_MIPMAP_NEAREST:
+        level := min(float32(math.Ceil(float64(lambda+0.5)))-1, last)
+        return t.sampleLevel(int(level), t.levelFilter(), s, u)
+    }
+    // NEAREST_MIPMAP_LINEAR, LINEAR_MIPMAP_LINEAR
+    lambda = min(lambda, last)
+    level := float32(math.Floor(float64(lambda)))
+    a := t.sampleLevel(int(level), t.levelFilter(), s, u)
+    if level == last {
+        return a
+    }
+    b := t.sampleLevel(int(level)+1, t.levelFilter(), s, u)
+    f := lambda - level
+    return a.scale(1 - f).add(b.scale(f))
+}
+
+// levelFilter returns the filter a mipmapped minification filter uses
+// within a level.
+func (t *texture) levelFilter() int {
+    if t.minFilter == NEAREST_MIPMAP_NEAREST || t.minFilter == NEAREST_MIPMAP_LINEAR {
+        return NEAREST
+    }
+    return LINEAR
+}
+
+// mipLevels returns how many levels from the base one can be sampled:
+// they stop at the first missing level or one of the wrong size.
+func (t *texture) mipLevels() int {
+    n := 1
+    for ; n < len(t.levels); n++ {
+        prev, l := t.levels[n-1], t.levels[n]
+        if prev.w == 1 && prev.h == 1 || l.w != max(prev.w/2, 1) || l.h != max(prev.h/2, 1) || len(l.texels) == 0 {
+            break
+        }
+    }
+    return n
+}
+
+// sampleLevel samples one level of t with filter NEAREST or LINEAR.
+func (t *texture) sampleLevel(level, filter int, s, u float32) SRColor {
+    img := &t.levels[level]
+    x, y := s*float32(img.w), u*float32(img.h)
+    if filter == NEAREST {
+        return img.texel(t, int(math.Floor(float64(x))), int(math.Floor(float64(y))))
+    }
+    x, y = x-0.5, y-0.5 // texel centers
+    x0, y0 := float32(math.Floor(float64(x))), float32(math.Floor(float64(y)))
+    fx, fy := x-x0, y-y0
+    i, j := int(x0), int(y0)
+    bottom := img.texel(t, i, j).scale(1 - fx).add(img.texel(t, i+1, j).scale(fx))
+    top := img.texel(t, i, j+1).scale(1 - fx).add(img.texel(t, i+1, j+1).scale(fx))
+    return bottom.scale(1 - fy).add(top.scale(fy))
+}
+
+// texel returns the texel at (i, j), wrapped into img as t says.
+func (img *texImage) texel(t *texture, i, j int) SRColor {
+    return img.texels[wrap(i, img.w, t.wrapS)+wrap(j, img.h, t.wrapT)*img.w]
+}
+
+func wrap(i, n, mode int) int {
+    switch mode {
+    case CLAMP:
+        return min(max(i, 0), n-1)
+    case MIRRORED_REPEAT:
+        i %= 2 * n
+        if i < 0 {
+            i += 2 * n
+        }
+        if i >= n {
+            i = 2*n - 1 - i
+        }
+        return i
+    }
+    i %= n
+    if i < 0 {
+        i += n
+    }
+    return i
+}
@@ -0,0 +1,137 @@
+package sr
+
+import (
+    "math"
+    "runtime"
+    "sync"
+)
+
+const tileSize = 32 // tile edge in pixels for the tiled rasterizer
+
+const (
+    primPoint = iota
+    primLine
+    primTriangle
+)
+
+// primitive is a transformed and lit point, line or triangle in window
+// coordinates, ready to be rasterized with the fragment state it was
+// emitted under.
+type primitive struct {
+    kind     int
+    v        [3]screenVertex
+    color    SRColor                       // color of the whole primitive unless smooth
+    specular SRColor                       // secondary color, added after texturing
+    smooth   bool
+    phong    bool                          // lit per pixel from the interpolated eye and normal
+    back     bool                          // phong lit as a back face
+    lighting *lightingState                // phong lit with, copied when emitted
+    tex      [maxTextureUnits]textureStage // applied in unit order
+    state    fragmentState
+}
+
+// screenVertex is a vertex in window coordinates: x and y in pixels and z
+// the depth, within DepthRange. invW is 1/w in clip space, which makes
+// the interpolation of the other attributes perspective-correct.
+type screenVertex struct {
+    x, y, z   float32
+    invW      float32
+    color     SRColor
+    specular  SRColor
+    eye       Vec3
+    normal    Vec3
+    texCoords [maxTextureUnits]Vec4
+    fog       float32
+}
+
+// rect is a pixel rectangle, x1 and y1 are exclusive.
+type rect struct {
+    x0, y0, x1, y1 int
+}
+
+func (r rect) contains(x, y int) bool {
+    return x >= r.x0 && x < r.x1 && y >= r.y0 && y < r.y1
+}
+
+func (r rect) intersect(o rect) rect {
+    return rect{max(r.x0, o.x0), max(r.y0, o.y0), min(r.x1, o.x1), min(r.y1, o.y1)}
+}
+
+func (r rect) empty() bool {
+    return r.x0 >= r.x1 || r.y0 >= r.y1
+}
+
+// bounds returns the pixels p can touch.
+func (p *primitive) bounds() rect {
+    n := 3
+    switch p.kind {
+    case primPoint: n = 1
+    case primLine:  n = 2
+    }
+    r := rect{math.MaxInt, math.MaxInt, math.MinInt, math.MinInt}
+    for _, v := range p.v[:n] {
+        x, y := int(math.Floor(float64(v.x))), int(math.Floor(float64(v.y)))
+        r = rect{min(r.x0, x), min(r.y0, y), max(r.x1, x+1), max(r.y1, y+1)}
+    }
+    return r
+}
+
+// SetWorkers selects the rasterizer. With n == 1 (the default) every
+// primitive is drawn as soon as it is assembled. With n > 1 primitives are
+// binned into screen tiles and the tiles are drawn by n goroutines on the
+// next End, ClearColor or ReadPixels. n <= 0 uses one worker per CPU.
+// Tiles are independent and each one draws its primitives in submission
+// order, so the image is identical to the serial one.
+func (ctx *Context) SetWorkers(n int) {
+    ctx.flush()
+    if n <= 0 {
+        n = runtime.GOMAXPROCS(0)
+    }
+    ctx.workers = n
+}
+
+// flush rasterizes the queued primitives tile by tile.
+func (ctx *Context) flush() {
+    if len(ctx.prims) == 0 {
+        return
+    }
+    screen := ctx.bounds()
+    cols := (screen.x1 + tileSize - 1) / tileSize
+    rows := (screen.y1 + tileSize - 1) / tileSize
+    bins := make([][]int, cols*rows)
+    for i := range ctx.prims {
+        b := ctx.prims[i].bounds().intersect(screen)
+        if b.empty() {
+            continue
+        }
+        for ty := b.y0 / tileSize; ty <= (b.y1-1)/tileSize; ty++ {
+            for tx := b.x0 / tileSize; tx <= (b.x1-1)/tileSize; tx++ {
+                bins[tx+ty*cols] = append(bins[tx+ty*cols], i)
+            }
+        }
+    }
+
+    tiles := make(chan int)
+    var wg sync.WaitGroup
+    for w := 0; w < ctx.workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for t := range tiles {
+                tx, ty := t%cols*tileSize, t/cols*tileSize
+                r := rect{tx, ty, tx + tileSize, ty + tileSize}.intersect(screen)
+                for _, i := range bins[t] {
+                    ctx.rasterize(&ctx.prims[i], r)
+                }
+            }
+        }()
+    }
+    for t := range bins {
+        if len(bins[t]) > 0 {
+            tiles <- t
+        }
+    }
+    close(tiles)
+    wg.Wait()
+    ctx.prims = ctx.prims[:0]
+}
@@ -0,0 +1,122 @@
+package sr
+
+import (
+    "math"
+    "math/rand"
+    "testing"
+)
+
+// drawScene draws random lit, textured, blended and fogged triangles,
+// lines and points with n rasterizer workers and returns the pixels. The
+// emission changes every three vertices.
+func drawScene(n, shadeModel int, extras bool) [][4]float32 {
+    ctx := NewContext()
+    ctx.Viewport(150, 100) // not a multiple of tileSize
+    ctx.SetWorkers(n)
+    ctx.SetCamera(Frustum(-1, 1, -1, 1, 1, 10), identity)
+    ctx.Enable(DEPTH_TEST)
+    ctx.Enable(LIGHTING0)
+    ctx.Enable(COLOR_MATERIAL)
+    ctx.Lightfv(LIGHTING0, POSITION, []float32{1, 1, 1, 0})
+    ctx.ShadeModel(shadeModel)
+    if extras {
+        ctx.TexImage2D(TEXTURE_2D, 0, 2, 2, RGBA, []float32{
+            1, 0, 0, 1, 0, 1, 0, 0.5,
+            0, 0, 1, 0.5, 1, 1, 1, 1,
+        })
+        ctx.Enable(TEXTURE_2D)
+        ctx.Enable(BLEND)
+        ctx.BlendFunc(SRC_ALPHA, ONE_MINUS_SRC_ALPHA)
+        ctx.Enable(FOG)
+        ctx.Fogf(FOG_DENSITY, 0.2)
+    }
+    r := rand.New(rand.NewSource(1))
+    coord := func() float32 { return r.Float32()*4 - 2 }
+    vertex := func() {
+        ctx.Color4f(r.Float32(), r.Float32(), r.Float32(), r.Float32())
+        ctx.Normal3f(coord(), coord(), 1)
+        ctx.TexCoord2f(coord(), coord())
+        ctx.Vertex3f(coord(), coord(), -1-r.Float32()*8)
+    }
+    for _, mode := range []int{TRIANGLES, LINES, POINTS} {
+        ctx.Begin(mode)
+        for i := 0; i < 300; i++ {
+            if i%3 == 0 { // legal within Begin/End, and lights what follows
+                ctx.Materialfv(FRONT_AND_BACK, EMISSION, []float32{r.Float32(), r.Float32(), r.Float32()})
+            }
+            vertex()
+        }
+        ctx.End()
+    }
+    return ctx.ReadPixelsRGBA()
+}
+
+func TestWorkersMatchSerial(t *testing.T) {
+    for _, shadeModel := range []int{FLAT, SMOOTH, PHONG} {
+        for _, extras := range []bool{false, true} {
+            serial, tiled := drawScene(1, shadeModel, extras), drawScene(8, shadeModel, extras)
+            for i := range serial {
+                if serial[i] != tiled[i] {
+                    t.Errorf("shade model %d, extras %v: pixel %d is %v tiled, %v serial",
+                        shadeModel, extras, i, tiled[i], serial[i])
+                    break
+                }
+            }
+        }
+    }
+}
+
+// TestFillRule covers the framebuffer with a jittered triangle mesh and
+// adds up the coverage: every pixel must be drawn exactly once, with no
+// gaps or double hits on shared edges.
+func TestFillRule(t *testing.T) {
+    const cells = 7
+    for _, n := range []int{1, 8} {
+        ctx := NewContext()
+        ctx.Viewport(97, 61)
+        ctx.SetWorkers(n)
+        ctx.SetCamera(identity, identity)
+        ctx.ClearColor4f(0, 0, 0, 0)
+        ctx.Enable(BLEND)
+        ctx.BlendFunc(ONE, ONE)
+        ctx.Color4f(0.25, 0.25, 0.25, 0.25)
+
+        r := rand.New(rand.NewSource(2))
+        var grid [cells + 1][cells + 1][2]float32
+        for i := range grid {
+            for j := range grid[i] {
+                px, py := float32(i)/cells*97, float32(j)/cells*61
+                if i > 0 && i < cells && j > 0 && j < cells { // keep the border on the framebuffer edges
+                    // on pixel centers, so edges between them run through
+                    // others, up to the rounding of the viewport transform
+                    px = float32(i*97/cells+r.Intn(5)-2) + 0.5
+                    py = float32(j*61/cells+r.Intn(5)-2) + 0.5
+                }
+                grid[i][j] = [2]float32{px/97*2 - 1, py/61*2 - 1}
+            }
+        }
+        ctx.Begin(TRIANGLES)
+        for i := 0; i < cells; i++ {
+            for j := 0; j < cells; j++ {
+                a, b, c, d := grid[i][j], grid[i+1][j], grid[i+1][j+1], grid[i][j+1]
+                for _, v := range [][2]float32{a, b, c, a, c, d} {
+                    ctx.Vertex3f(v[0], v[1], 0)
+                }
+            }
+        }
+        ctx.End()
+        // a fan around an off-center point, drawn on top, adds 0.25 again
+        ctx.Begin(TRIANGLE_FAN)
+        ctx.Vertex3f(0.13, -0.21, 0)
+        for _, v := range [][2]float32{{-1, -1}, {0.3, -1}, {1, -1}, {1, 0.4}, {1, 1}, {-0.6, 1}, {-1, 1}, {-1, -0.1}, {-1, -1}} {
+            ctx.Vertex3f(v[0], v[1], 0)
+        }
+        ctx.End()
+
+        for i, p := range ctx.ReadPixelsRGBA() {
+            if hits := math.Round(float64(p[0] / 0.25)); hits != 2 { // interpolation leaves 0.24999999
+                t.Fatalf("workers %d: pixel (%d, %d) covered %v times, want 2", n, i%97, i/97, hits)
+            }
+        }
+    }
+}